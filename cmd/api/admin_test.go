@@ -0,0 +1,438 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+const (
+	adminToken    = "Bearer TokenPlainTextForTokenTes0"
+	nonAdminToken = "Bearer TokenPlainTextForTokenTest"
+)
+
+type adminTestCase struct {
+	name     string
+	token    string
+	urlPath  string
+	body     string
+	wantCode int
+	wantBody string
+}
+
+func runAdminTests(t *testing.T, method string, tests []adminTestCase) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			var body []byte
+			if tt.body != "" {
+				body = []byte(tt.body)
+			}
+
+			code, _, respBody := ts.doForAuth(t, method, tt.urlPath, body, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, respBody, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	runAdminTests(t, http.MethodGet, []adminTestCase{
+		{
+			name:     "Valid request",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users?q=test&activated=true&sort=-email",
+			wantCode: http.StatusOK,
+			wantBody: `"total_records":1`,
+		},
+		{
+			name:     "Not an admin",
+			token:    nonAdminToken,
+			urlPath:  "/v1/admin/users",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Anonymous",
+			token:    "",
+			urlPath:  "/v1/admin/users",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Invalid activated",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users?activated=maybe",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Invalid sort",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users?sort=password_hash",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Database error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users?q=error",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users",
+			wantCode: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestShowUser(t *testing.T) {
+	runAdminTests(t, http.MethodGet, []adminTestCase{
+		{
+			name:     "Valid ID",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/1",
+			wantCode: http.StatusOK,
+			wantBody: `"roles":["viewer"]`,
+		},
+		{
+			name:     "Non-existent ID",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/3",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid ID",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/abc",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/4",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Permissions error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/2",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/1",
+			wantCode: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestChangeUserPermissions(t *testing.T) {
+	tests := []adminTestCase{
+		{
+			name:     "Valid request",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/5/permissions",
+			body:     `{"permissions": ["movies:write"]}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Unknown permission",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/5/permissions",
+			body:     `{"permissions": ["movies:burn"]}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "No permissions",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/5/permissions",
+			body:     `{"permissions": []}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Duplicate permissions",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/5/permissions",
+			body:     `{"permissions": ["movies:write", "movies:write"]}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Wrong input",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/5/permissions",
+			body:     `{"permissions": "movies:write"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Non-existent ID",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/3/permissions",
+			body:     `{"permissions": ["movies:write"]}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/1/permissions",
+			body:     `{"permissions": ["movies:write"]}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Audit error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/6/permissions",
+			body:     `{"permissions": ["movies:write"]}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Not an admin",
+			token:    nonAdminToken,
+			urlPath:  "/v1/admin/users/5/permissions",
+			body:     `{"permissions": ["movies:write"]}`,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/5/permissions",
+			body:     `{"permissions": ["movies:write"]}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	t.Run("grant", func(t *testing.T) {
+		runAdminTests(t, http.MethodPost, tests)
+	})
+	t.Run("revoke", func(t *testing.T) {
+		runAdminTests(t, http.MethodDelete, tests)
+	})
+}
+
+func TestUpdateUserSuspended(t *testing.T) {
+	runAdminTests(t, http.MethodPut, []adminTestCase{
+		{
+			name:     "Suspend",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/5/suspended",
+			body:     `{"suspended": true}`,
+			wantCode: http.StatusOK,
+			wantBody: `"suspended_at"`,
+		},
+		{
+			name:     "Unsuspend",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/9/suspended",
+			body:     `{"suspended": false}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Suspend self",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/7/suspended",
+			body:     `{"suspended": true}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Missing suspended",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/5/suspended",
+			body:     `{}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Database error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/2/suspended",
+			body:     `{"suspended": true}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Audit error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/6/suspended",
+			body:     `{"suspended": true}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Wrong input",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/5/suspended",
+			body:     `{"suspended": "no"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Not an admin",
+			token:    nonAdminToken,
+			urlPath:  "/v1/admin/users/5/suspended",
+			body:     `{"suspended": true}`,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/5/suspended",
+			body:     `{"suspended": true}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestSuspendedUserLockedOut(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		urlPath  string
+		body     string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "Bearer token",
+			method:   http.MethodGet,
+			urlPath:  "/v1/users/me/sessions",
+			token:    "Bearer TokenPlainTextForTokenTesS",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "API key",
+			method:   http.MethodGet,
+			urlPath:  "/v1/movies",
+			token:    "ApiKey APIKeyPlainTextForAPIKeyTestAPIKeyPlainTextForAPIKeS",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Password login",
+			method:   http.MethodPost,
+			urlPath:  "/v1/tokens/authentication",
+			body:     `{"email": "test9@test.com", "password": "TestPassword"}`,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Refresh",
+			method:   http.MethodPost,
+			urlPath:  "/v1/tokens/refresh",
+			body:     `{"refresh_token": "TokenPlainTextForTokenTesS"}`,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Activation",
+			method:   http.MethodPut,
+			urlPath:  "/v1/users/activated",
+			body:     `{"token": "TokenPlainTextForTokenTesS"}`,
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			if tt.body != "" {
+				body = []byte(tt.body)
+			}
+
+			code, _, respBody := ts.doForAuth(t, tt.method, tt.urlPath, body, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, respBody, "your user account has been suspended")
+		})
+	}
+}
+
+func TestDeleteUserSessions(t *testing.T) {
+	runAdminTests(t, http.MethodDelete, []adminTestCase{
+		{
+			name:     "Valid ID",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/1/sessions",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Non-existent ID",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/3/sessions",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/2/sessions",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Audit error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/6/sessions",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/1/sessions",
+			wantCode: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestUnlockUser(t *testing.T) {
+	runAdminTests(t, http.MethodDelete, []adminTestCase{
+		{
+			name:     "Valid ID",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/1/lockout",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Non-existent ID",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/3/lockout",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/4/lockout",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Invalid ID",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/abc/lockout",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Audit error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/6/lockout",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Not an admin",
+			token:    nonAdminToken,
+			urlPath:  "/v1/admin/users/1/lockout",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    adminToken,
+			urlPath:  "/v1/admin/users/1/lockout",
+			wantCode: http.StatusInternalServerError,
+		},
+	})
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	const validToken = "Bearer TokenPlainTextForTokenTest"
+
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		token       string
+		Name        string
+		Permissions []string
+		Expiry      *time.Time
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:        "Valid submission",
+			token:       validToken,
+			Name:        "ingestion",
+			Permissions: []string{"movies:read"},
+			wantCode:    http.StatusCreated,
+			wantBody:    `"key":`,
+		},
+		{
+			name:        "Anonymous",
+			token:       "",
+			Name:        "ingestion",
+			Permissions: []string{"movies:read"},
+			wantCode:    http.StatusUnauthorized,
+		},
+		{
+			name:        "Empty name",
+			token:       validToken,
+			Name:        "",
+			Permissions: []string{"movies:read"},
+			wantCode:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "Expiry in the past",
+			token:       validToken,
+			Name:        "ingestion",
+			Permissions: []string{"movies:read"},
+			Expiry:      &past,
+			wantCode:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "Permission not held",
+			token:       validToken,
+			Name:        "ingestion",
+			Permissions: []string{"movies:write"},
+			wantCode:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "Permissions database fall",
+			token:       "Bearer TokenPlainTextForTokenTes5",
+			Name:        "ingestion",
+			Permissions: []string{"movies:read"},
+			wantCode:    http.StatusInternalServerError,
+		},
+		{
+			name:        "Insert database fall",
+			token:       validToken,
+			Name:        "database fall",
+			Permissions: []string{"movies:read"},
+			wantCode:    http.StatusInternalServerError,
+		},
+		{
+			name:        "Fake json.Write",
+			token:       validToken,
+			Name:        "ingestion",
+			Permissions: []string{"movies:read"},
+			wantCode:    http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			inputData := struct {
+				Name        string     `json:"name"`
+				Permissions []string   `json:"permissions"`
+				Expiry      *time.Time `json:"expiry,omitempty"`
+			}{
+				Name:        tt.Name,
+				Permissions: tt.Permissions,
+				Expiry:      tt.Expiry,
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, _, body := ts.postForAuth(t, "/v1/users/me/api-keys", b, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	code, _, _ := ts.postForAuth(t, "/v1/users/me/api-keys", []byte{}, validToken)
+
+	assert.Equal(t, code, http.StatusBadRequest)
+}
+
+func TestListAPIKeys(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "Valid req",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Anonymous",
+			token:    "",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Database fall",
+			token:    "Bearer TokenPlainTextForTokenTes5",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, _ := ts.getForAuth(t, "/v1/users/me/api-keys", tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestDeleteAPIKey(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "Revoke key",
+			urlPath:  "/v1/users/me/api-keys/1",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/v1/users/me/api-keys/3",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/v1/users/me/api-keys/foo",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/users/me/api-keys/1",
+			token:    "Bearer TokenPlainTextForTokenTes5",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/users/me/api-keys/1",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, _ := ts.deleteForAuth(t, tt.urlPath, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
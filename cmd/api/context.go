@@ -8,7 +8,20 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	tokenContextKey       = contextKey("token")
+	permissionsContextKey = contextKey("permissions")
+	orgContextKey         = contextKey("organization")
+	authMethodContextKey  = contextKey("authMethod")
+)
+
+// How a request was authenticated. A session is one the user logged in to, with a bearer
+// token of either auth mode.
+const (
+	authMethodSession = "session"
+	authMethodAPIKey  = "api_key"
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -22,3 +35,52 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+func (app *application) contextSetToken(r *http.Request, tokenPlaintext string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, tokenPlaintext)
+	return r.WithContext(ctx)
+}
+
+// contextGetToken returns the bearer token the request was authenticated with, or an empty
+// string if it was authenticated some other way, such as with an API key.
+func (app *application) contextGetToken(r *http.Request) string {
+	token, _ := r.Context().Value(tokenContextKey).(string)
+	return token
+}
+
+// contextSetPermissions is used when the credentials themselves carry the user's
+// permissions, so requirePermission doesn't have to look them up.
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
+
+func (app *application) contextSetOrganization(r *http.Request, org *data.Organization) *http.Request {
+	ctx := context.WithValue(r.Context(), orgContextKey, org)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetOrganization(r *http.Request) *data.Organization {
+	org, ok := r.Context().Value(orgContextKey).(*data.Organization)
+	if !ok {
+		panic("missing organization value in request context")
+	}
+	return org
+}
+
+func (app *application) contextSetAuthMethod(r *http.Request, method string) *http.Request {
+	ctx := context.WithValue(r.Context(), authMethodContextKey, method)
+	return r.WithContext(ctx)
+}
+
+// contextGetAuthMethod returns how the request was authenticated, or an empty string for
+// an anonymous request.
+func (app *application) contextGetAuthMethod(r *http.Request) string {
+	method, _ := r.Context().Value(authMethodContextKey).(string)
+	return method
+}
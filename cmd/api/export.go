@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"greenlight.bcc/internal/data"
+)
+
+// An export is flushed to the client every exportFlushMovies movies, and each flush gives
+// it another exportWriteTimeout to write the next ones. The server's write timeout would
+// otherwise cut off any export which took longer than it in total.
+const (
+	exportFlushMovies  = 100
+	exportWriteTimeout = 30 * time.Second
+)
+
+// movieEncoder writes movies to an export as they are read. begin is called once before
+// any movie is written and end once after the last, so that a format can wrap the movies
+// in a header or a document. flush writes out anything the encoder is holding back.
+type movieEncoder interface {
+	begin() error
+	encode(movie *data.Movie) error
+	flush() error
+	end() error
+}
+
+// exportMoviesHandler streams every movie matching the title and genres filters of
+// listMoviesHandler, with no paging. The format is picked from the Accept header: JSON
+// (the default), NDJSON or CSV. Movies are written as they are read from the database,
+// and the query is cancelled if the client goes away. The write deadline is moved on as
+// the export is flushed, so it only times out if the client stops reading.
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.MovieSearch
+	qs := r.URL.Query()
+
+	input.Title = app.readString(qs, "title", "")
+	input.Genres = app.readCSV(qs, "genres", []string{})
+
+	offers := []string{"application/json", "application/x-ndjson", "text/csv"}
+
+	contentType := app.negotiateContentType(r, offers...)
+
+	var enc movieEncoder
+	var ext string
+	switch contentType {
+	case "application/json":
+		enc, ext = &jsonMovieEncoder{w: w, enc: json.NewEncoder(w)}, "json"
+	case "application/x-ndjson":
+		enc, ext = &ndjsonMovieEncoder{enc: json.NewEncoder(w)}, "ndjson"
+	case "text/csv":
+		enc, ext = &csvMovieEncoder{w: csv.NewWriter(w)}, "csv"
+	default:
+		app.notAcceptableResponse(w, r, offers...)
+		return
+	}
+
+	// http.ErrNotSupported means the writer has no deadline to move or nothing to flush,
+	// as with a ResponseRecorder, and the export carries on without.
+	rc := http.NewResponseController(w)
+	extendDeadline := func() error {
+		err := rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+	flush := func() error {
+		err := enc.flush()
+		if err != nil {
+			return err
+		}
+		err = rc.Flush()
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return extendDeadline()
+	}
+
+	// The response isn't started until the first movie has been read, so that a query
+	// which fails straight away still gets an ordinary error response.
+	started := false
+	start := func() error {
+		started = true
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.`+ext+`"`)
+		w.WriteHeader(http.StatusOK)
+
+		return enc.begin()
+	}
+
+	// Reading the first movie can take a while for a large catalogue, so it gets a deadline
+	// of its own too.
+	err := extendDeadline()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	encoded := 0
+	err = app.models.Movies.Export(r.Context(), app.contextGetOrganization(r).ID, input, func(movie *data.Movie) error {
+		if !started {
+			err := start()
+			if err != nil {
+				return err
+			}
+		}
+
+		err := enc.encode(movie)
+		if err != nil {
+			return err
+		}
+
+		encoded++
+		if encoded%exportFlushMovies == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = enc.end()
+	}
+	if err != nil {
+		switch {
+		case r.Context().Err() != nil:
+			// The client has gone, and there is no one left to tell.
+		case !started:
+			app.serverErrorResponse(w, r, err)
+		default:
+			app.logError(r, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// jsonMovieEncoder writes the movies as an array in an envelope, like the other movie
+// endpoints, one movie per line.
+type jsonMovieEncoder struct {
+	w       io.Writer
+	enc     *json.Encoder
+	encoded bool
+}
+
+func (e *jsonMovieEncoder) begin() error {
+	_, err := io.WriteString(e.w, `{"movies":[`+"\n")
+	return err
+}
+
+func (e *jsonMovieEncoder) encode(movie *data.Movie) error {
+	if e.encoded {
+		_, err := io.WriteString(e.w, ",")
+		if err != nil {
+			return err
+		}
+	}
+	e.encoded = true
+
+	return e.enc.Encode(movie)
+}
+
+func (e *jsonMovieEncoder) flush() error {
+	return nil
+}
+
+func (e *jsonMovieEncoder) end() error {
+	_, err := io.WriteString(e.w, "]}\n")
+	return err
+}
+
+// ndjsonMovieEncoder writes each movie as a JSON object on a line of its own.
+type ndjsonMovieEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonMovieEncoder) begin() error {
+	return nil
+}
+
+func (e *ndjsonMovieEncoder) encode(movie *data.Movie) error {
+	return e.enc.Encode(movie)
+}
+
+func (e *ndjsonMovieEncoder) flush() error {
+	return nil
+}
+
+func (e *ndjsonMovieEncoder) end() error {
+	return nil
+}
+
+// csvMovieEncoder writes a header row and a row for each movie. The runtime is a number
+// of minutes and the genres are separated by commas, as importMoviesHandler reads them.
+type csvMovieEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvMovieEncoder) begin() error {
+	return e.w.Write([]string{"id", "title", "year", "runtime", "genres", "average_rating", "rating_count", "version"})
+}
+
+func (e *csvMovieEncoder) encode(movie *data.Movie) error {
+	return e.w.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		strconv.FormatInt(int64(movie.Year), 10),
+		strconv.FormatInt(int64(movie.Runtime), 10),
+		strings.Join(movie.Genres, ","),
+		strconv.FormatFloat(movie.AverageRating, 'f', 2, 64),
+		strconv.FormatInt(int64(movie.RatingCount), 10),
+		strconv.FormatInt(int64(movie.Version), 10),
+	})
+}
+
+// flush writes the rows the csv.Writer is still holding. Writes are buffered, so this is
+// also where an error writing any of them is found.
+func (e *csvMovieEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvMovieEncoder) end() error {
+	return e.flush()
+}
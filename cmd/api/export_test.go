@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestExportMovies(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		accept          string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{name: "Default", urlPath: "/v1/movies/export", wantCode: http.StatusOK, wantContentType: "application/json", wantBody: `{"movies":[` + "\n" + `{"id":1,"title":"Test Mock"`},
+		{name: "Any type", urlPath: "/v1/movies/export", accept: "*/*", wantCode: http.StatusOK, wantContentType: "application/json"},
+		{name: "NDJSON", urlPath: "/v1/movies/export", accept: "application/x-ndjson", wantCode: http.StatusOK, wantContentType: "application/x-ndjson", wantBody: `"rating_count":2}` + "\n" + `{"id":5,"title":"Uncredited Mock"`},
+		{name: "CSV", urlPath: "/v1/movies/export", accept: "text/csv", wantCode: http.StatusOK, wantContentType: "text/csv", wantBody: "id,title,year,runtime,genres,average_rating,rating_count,version\n1,Test Mock,2023,105,\"drama,crime\",7.50,2,1\n"},
+		{name: "Text range", urlPath: "/v1/movies/export", accept: "text/*", wantCode: http.StatusOK, wantContentType: "text/csv"},
+		{name: "Quality", urlPath: "/v1/movies/export", accept: "application/json;q=0.5, text/csv;q=0.9, text/html", wantCode: http.StatusOK, wantContentType: "text/csv"},
+		{name: "Refused type", urlPath: "/v1/movies/export", accept: "text/csv;q=0, application/xml", wantCode: http.StatusNotAcceptable, wantBody: "application/json, application/x-ndjson, text/csv"},
+		{name: "Database fall", urlPath: "/v1/movies/export?title=fall+database", wantCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.accept != "" {
+				headers["Accept"] = tt.accept
+			}
+
+			code, header, body := ts.doWithHeaders(t, http.MethodGet, tt.urlPath, nil, headers)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantContentType != "" {
+				assert.Equal(t, header.Get("Content-Type"), tt.wantContentType)
+			}
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Valid JSON", func(t *testing.T) {
+		_, _, body := ts.get(t, "/v1/movies/export")
+
+		var export struct {
+			Movies []map[string]any `json:"movies"`
+		}
+		err := json.Unmarshal([]byte(body), &export)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, len(export.Movies), 2)
+	})
+
+	t.Run("Fall midway", func(t *testing.T) {
+		rs, err := ts.Client().Get(ts.URL + "/v1/movies/export?title=fall+midway")
+		if err == nil {
+			defer rs.Body.Close()
+			_, err = io.ReadAll(rs.Body)
+		}
+
+		// The movies already sent can't be taken back, so the connection is dropped
+		// rather than letting the export look complete.
+		assert.Equal(t, err != nil, true)
+	})
+}
+
+func TestExportMoviesWriteTimeout(t *testing.T) {
+	app := newTestApplication(t)
+
+	// The export takes longer than the server's write timeout, which should only limit
+	// how long it goes without being flushed.
+	ts := httptest.NewUnstartedServer(app.routesTest())
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	rs, err := ts.Client().Get(ts.URL + "/v1/movies/export?title=slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var export struct {
+		Movies []map[string]any `json:"movies"`
+	}
+	err = json.Unmarshal(body, &export)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(export.Movies), 252)
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"greenlight.bcc/internal/validator"
 	"io"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -131,6 +133,68 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// readBool returns nil when the key is absent, so callers can tell "not filtered" apart
+// from false.
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
+
+// negotiateContentType picks which of offers to respond with from the request's Accept
+// header. The range with the highest quality wins, and the earlier one of equal ranges;
+// an empty header accepts the first offer. "" means none of offers are acceptable.
+func (app *application) negotiateContentType(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if quality <= bestQuality {
+			continue
+		}
+
+		for _, offer := range offers {
+			if mediaRange == "*/*" || mediaRange == offer || (strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mediaRange, "*"))) {
+				best, bestQuality = offer, quality
+				break
+			}
+		}
+	}
+
+	return best
+}
+
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 	go func() {
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.bcc/internal/blob"
+	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/validator"
+)
+
+// minImageDimension is the smallest width and height accepted for an upload. Anything
+// smaller is too small to be useful even as a thumbnail.
+const minImageDimension = 50
+
+// uploadMovieImageHandler replaces the movie's poster or backdrop with the image in the
+// "image" field of a multipart form. The thumbnails are generated in the background, and
+// appear on the movie once they are ready.
+func (app *application) uploadMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	kind := httprouter.ParamsFromContext(r.Context()).ByName("kind")
+	if !validator.PermittedValue(kind, data.ImageKinds...) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	orgID := app.contextGetOrganization(r).ID
+
+	movie, err := app.models.Movies.Get(orgID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	content, err := app.readUpload(w, r, "image")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	img, format := app.decodeImage(v, content)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	randomBytes := make([]byte, 10)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ext := ".png"
+	if format == "jpeg" {
+		ext = ".jpg"
+	}
+
+	key := fmt.Sprintf("movies/%d/%s-%s%s", movie.ID, kind, strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)), ext)
+
+	err = app.blobs.Put(r.Context(), key, bytes.NewReader(content))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	old, err := app.models.Movies.SetImage(orgID, movie.ID, kind, key)
+	if err != nil {
+		app.deleteBlobs(key)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		if old != nil {
+			app.deleteBlobs(old.Keys(kind)...)
+		}
+		app.generateThumbnails(orgID, movie.ID, kind, key, img)
+	})
+
+	if kind == data.ImagePoster {
+		movie.Poster = &data.Image{Key: key}
+	} else {
+		movie.Backdrop = &data.Image{Key: key}
+	}
+	app.setImageURLs(movie)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	kind := httprouter.ParamsFromContext(r.Context()).ByName("kind")
+	if !validator.PermittedValue(kind, data.ImageKinds...) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	old, err := app.models.Movies.SetImage(app.contextGetOrganization(r).ID, id, kind, "")
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if old == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	app.background(func() {
+		app.deleteBlobs(old.Keys(kind)...)
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": fmt.Sprintf("%s successfully deleted", kind)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// serveImageHandler sends a file from the blob store. Keys contain a random part, so
+// images can be served without authentication in the same way as public lists.
+func (app *application) serveImageHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(httprouter.ParamsFromContext(r.Context()).ByName("key"), "/")
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if !strings.HasPrefix(contentType, "image/") {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	f, err := app.blobs.Get(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer f.Close()
+
+	// A key is never reused for different content, so the file can be cached forever.
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	_, err = io.Copy(w, f)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"key": key})
+	}
+}
+
+// readUpload returns the contents of the named file field of a multipart form. Like
+// readJSON, the errors it returns are meant for the client.
+func (app *application) readUpload(w http.ResponseWriter, r *http.Request, field string) ([]byte, error) {
+	maxBytes := app.config.images.maxBytes
+
+	// Leave some room for the rest of the form, so that a file slightly over the limit
+	// gets an error about the file rather than about the body.
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1_048_576)
+
+	err := r.ParseMultipartForm(maxBytes)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &maxBytesError):
+			return nil, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		case errors.Is(err, http.ErrNotMultipart):
+			return nil, errors.New("body must be a multipart form")
+		default:
+			return nil, errors.New("body contains a badly-formed multipart form")
+		}
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile(field)
+	if err != nil {
+		return nil, fmt.Errorf("body must contain the %s file", field)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(content)) > maxBytes {
+		return nil, fmt.Errorf("%s must not be larger than %d bytes", field, maxBytes)
+	}
+
+	return content, nil
+}
+
+// decodeImage checks that the upload is a JPEG or PNG image of an acceptable size and
+// decodes it. The type is sniffed from the content, because the client's Content-Type
+// and file name can't be trusted.
+func (app *application) decodeImage(v *validator.Validator, content []byte) (image.Image, string) {
+	contentType := http.DetectContentType(content)
+	if !validator.PermittedValue(contentType, "image/jpeg", "image/png") {
+		v.AddError("image", "must be a JPEG or PNG image")
+		return nil, ""
+	}
+
+	// The dimensions are checked before decoding, so that a small file which claims to
+	// be huge can't make us allocate gigabytes.
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		v.AddError("image", "must be a valid image")
+		return nil, ""
+	}
+
+	maxDimension := app.config.images.maxDimension
+	v.Check(config.Width >= minImageDimension && config.Height >= minImageDimension, "image", fmt.Sprintf("must be at least %d pixels wide and high", minImageDimension))
+	v.Check(config.Width <= maxDimension && config.Height <= maxDimension, "image", fmt.Sprintf("must not be more than %d pixels wide or high", maxDimension))
+	if !v.Valid() {
+		return nil, ""
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		v.AddError("image", "must be a valid image")
+		return nil, ""
+	}
+
+	return img, format
+}
+
+// generateThumbnails stores a JPEG thumbnail of the image for each of the widths used for
+// its kind, largest first so that each one can be scaled down from the last.
+func (app *application) generateThumbnails(orgID, movieID int64, kind, key string, img image.Image) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	widths := data.ThumbnailWidths[kind]
+	keys := make([]string, 0, len(widths))
+
+	for i := len(widths) - 1; i >= 0; i-- {
+		img = thumbnail(img, widths[i])
+
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		if err == nil {
+			thumbnailKey := data.ThumbnailKey(key, widths[i])
+			err = app.blobs.Put(ctx, thumbnailKey, &buf)
+			keys = append(keys, thumbnailKey)
+		}
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"key": key})
+			app.deleteBlobs(keys...)
+			return
+		}
+	}
+
+	err := app.models.Movies.SetImageThumbnails(orgID, movieID, kind, key)
+	if err != nil {
+		// The image was replaced or removed while we were working, and nothing will
+		// refer to these thumbnails.
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.PrintError(err, map[string]string{"key": key})
+		}
+		app.deleteBlobs(keys...)
+	}
+}
+
+// deleteBlobs deletes the files, logging rather than returning errors. It is used for
+// cleaning up, where there's nothing better to do with an error.
+func (app *application) deleteBlobs(keys ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, key := range keys {
+		err := app.blobs.Delete(ctx, key)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"key": key})
+		}
+	}
+}
+
+// setImageURLs fills in where the movies' images and thumbnails can be downloaded from.
+func (app *application) setImageURLs(movies ...*data.Movie) {
+	for _, movie := range movies {
+		for kind, image := range map[string]*data.Image{data.ImagePoster: movie.Poster, data.ImageBackdrop: movie.Backdrop} {
+			if image == nil {
+				continue
+			}
+
+			image.URL = app.blobs.URL(image.Key)
+
+			if image.HasThumbnails {
+				image.Thumbnails = make(map[string]string)
+				for _, width := range data.ThumbnailWidths[kind] {
+					image.Thumbnails[fmt.Sprintf("w%d", width)] = app.blobs.URL(data.ThumbnailKey(image.Key, width))
+				}
+			}
+		}
+	}
+}
+
+// thumbnail scales img down to width pixels wide, keeping its aspect ratio. Each pixel is
+// the average of the ones it covers in the original, and transparent areas are filled
+// with white since JPEGs have no alpha channel. Images are never scaled up.
+func thumbnail(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if width > bounds.Dx() {
+		width = bounds.Dx()
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			// The colours are premultiplied by alpha, so adding the missing alpha puts
+			// them over white.
+			white := 0xffff - a/n
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r/n + white),
+				G: uint16(g/n + white),
+				B: uint16(b/n + white),
+				A: 0xffff,
+			})
+		}
+	}
+
+	return dst
+}
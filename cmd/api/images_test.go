@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func encodeTestImage(t *testing.T, format string, width, height int, noise bool) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255}
+			if noise {
+				c = color.RGBA{R: uint8(rand.Intn(256)), G: uint8(rand.Intn(256)), B: uint8(rand.Intn(256)), A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func multipartBody(t *testing.T, field string, content []byte) ([]byte, string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	fw, err := mw.CreateFormFile(field, "upload.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fw.Write(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes(), mw.FormDataContentType()
+}
+
+func TestUploadMovieImage(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	validPNG := encodeTestImage(t, "png", 400, 600, false)
+	truncatedPNG := validPNG[:len(validPNG)/2]
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		field    string
+		content  []byte
+		wantCode int
+		wantBody string
+	}{
+		{name: "Poster", urlPath: "/v1/movies/1/images/poster", content: validPNG, wantCode: http.StatusOK, wantBody: `"poster":{"url":"/v1/images/movies/1/poster-`},
+		{name: "JPEG backdrop", urlPath: "/v1/movies/1/images/backdrop", content: encodeTestImage(t, "jpeg", 800, 450, false), wantCode: http.StatusOK, wantBody: `.jpg"}`},
+		{name: "Unknown kind", urlPath: "/v1/movies/1/images/banner", content: validPNG, wantCode: http.StatusNotFound},
+		{name: "Non-existent movie", urlPath: "/v1/movies/3/images/poster", content: validPNG, wantCode: http.StatusNotFound},
+		{name: "Not an image", urlPath: "/v1/movies/1/images/poster", content: []byte("<html><body>poster</body></html>"), wantCode: http.StatusUnprocessableEntity, wantBody: "must be a JPEG or PNG image"},
+		{name: "GIF", urlPath: "/v1/movies/1/images/poster", content: encodeTestImage(t, "gif", 100, 100, false), wantCode: http.StatusUnprocessableEntity, wantBody: "must be a JPEG or PNG image"},
+		{name: "Too small", urlPath: "/v1/movies/1/images/poster", content: encodeTestImage(t, "png", 10, 10, false), wantCode: http.StatusUnprocessableEntity, wantBody: "must be at least 50 pixels"},
+		{name: "Too wide", urlPath: "/v1/movies/1/images/poster", content: encodeTestImage(t, "png", 1200, 60, false), wantCode: http.StatusUnprocessableEntity, wantBody: "must not be more than 1000 pixels"},
+		{name: "Truncated", urlPath: "/v1/movies/1/images/poster", content: truncatedPNG, wantCode: http.StatusUnprocessableEntity, wantBody: "must be a valid image"},
+		{name: "Too many bytes", urlPath: "/v1/movies/1/images/poster", content: encodeTestImage(t, "png", 200, 200, true), wantCode: http.StatusBadRequest, wantBody: "image must not be larger than 65536 bytes"},
+		{name: "Wrong field", urlPath: "/v1/movies/1/images/poster", field: "file", content: validPNG, wantCode: http.StatusBadRequest, wantBody: "body must contain the image file"},
+		{name: "Database fall", urlPath: "/v1/movies/2/images/poster", content: validPNG, wantCode: http.StatusInternalServerError},
+		{name: "Fake json.Write", urlPath: "/v1/movies/1/images/poster", content: validPNG, wantCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			field := tt.field
+			if field == "" {
+				field = "image"
+			}
+			body, contentType := multipartBody(t, field, tt.content)
+
+			code, _, respBody := ts.doWithHeaders(t, http.MethodPut, tt.urlPath, body, map[string]string{"Content-Type": contentType})
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, respBody, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Not multipart", func(t *testing.T) {
+		code, _, body := ts.doForAuth(t, http.MethodPut, "/v1/movies/1/images/poster", []byte(`{"image": "poster.png"}`), "")
+
+		assert.Equal(t, code, http.StatusBadRequest)
+		assert.StringContains(t, body, "must be a multipart form")
+	})
+
+	t.Run("Thumbnails", func(t *testing.T) {
+		body, contentType := multipartBody(t, "image", validPNG)
+
+		code, _, respBody := ts.doWithHeaders(t, http.MethodPut, "/v1/movies/1/images/poster", body, map[string]string{"Content-Type": contentType})
+		assert.Equal(t, code, http.StatusOK)
+
+		url := regexp.MustCompile(`/v1/images/movies/1/poster-[a-z0-9]+`).FindString(respBody)
+		if url == "" {
+			t.Fatalf("no poster URL in %q", respBody)
+		}
+
+		app.wg.Wait()
+
+		for _, width := range []string{"92", "185", "342"} {
+			code, header, _ := ts.get(t, url+"-w"+width+".jpg")
+
+			assert.Equal(t, code, http.StatusOK)
+			assert.Equal(t, header.Get("Content-Type"), "image/jpeg")
+		}
+	})
+}
+
+func TestDeleteMovieImage(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/movies/1/images/poster",
+			wantCode: http.StatusOK,
+			wantBody: "poster successfully deleted",
+		},
+		{
+			name:     "No image",
+			urlPath:  "/v1/movies/5/images/backdrop",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Unknown kind",
+			urlPath:  "/v1/movies/1/images/banner",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent movie",
+			urlPath:  "/v1/movies/3/images/poster",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/v1/movies/string/images/poster",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/movies/2/images/poster",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/movies/1/images/poster",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.deleteReq(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServeImage(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	content := encodeTestImage(t, "png", 60, 60, false)
+
+	for key, value := range map[string][]byte{"movies/1/poster-abc.png": content, "movies/1/notes.txt": []byte("notes")} {
+		err := app.blobs.Put(context.Background(), key, bytes.NewReader(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{name: "Valid request", urlPath: "/v1/images/movies/1/poster-abc.png", wantCode: http.StatusOK},
+		{name: "Non-existent image", urlPath: "/v1/images/movies/1/poster-xyz.png", wantCode: http.StatusNotFound},
+		{name: "Not an image", urlPath: "/v1/images/movies/1/notes.txt", wantCode: http.StatusNotFound},
+		{name: "Escaped traversal", urlPath: "/v1/images/..%2F..%2Fetc%2Fpasswd.png", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusOK {
+				assert.Equal(t, header.Get("Content-Type"), "image/png")
+				assert.StringContains(t, header.Get("Cache-Control"), "immutable")
+				assert.Equal(t, body, string(content))
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+
+	thumb := thumbnail(img, 92)
+
+	assert.Equal(t, thumb.Bounds().Dx(), 92)
+	assert.Equal(t, thumb.Bounds().Dy(), 46)
+
+	// Transparent pixels are put over white.
+	assert.Equal(t, thumb.(*image.RGBA).RGBAAt(10, 10), color.RGBA{R: 255, G: 255, B: 255, A: 255})
+
+	// Small images aren't scaled up.
+	assert.Equal(t, thumbnail(img, 1000).Bounds().Dx(), 400)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/validator"
+)
+
+const (
+	importModeAllOrNothing = "all_or_nothing"
+	importModeSkipInvalid  = "skip_invalid"
+)
+
+// maxImportLine is the longest line accepted in an NDJSON import, the same as the largest
+// body readJSON accepts for a single movie.
+const maxImportLine = 1_048_576
+
+// importRowError holds what is wrong with one row of an import. Line is the row's line in
+// the body, counting from 1, so that it can be found and fixed.
+type importRowError struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+// importRowFunc is called by the import readers for each row. movie is nil if the row
+// couldn't be read at all, in which case v holds the reason.
+type importRowFunc func(line int, movie *data.Movie, v *validator.Validator)
+
+// importMoviesHandler adds the movies in a CSV or NDJSON body. Every row is validated like
+// the body of createMovieHandler. In the default all_or_nothing mode any invalid row
+// stops the import, while skip_invalid imports the valid rows and leaves the rest out;
+// either way the invalid rows are reported.
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	mode := app.readString(r.URL.Query(), "mode", importModeAllOrNothing)
+	if !validator.PermittedValue(mode, importModeAllOrNothing, importModeSkipInvalid) {
+		v.AddError("mode", "must be one of all_or_nothing or skip_invalid")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var read func(io.Reader, importRowFunc) error
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		read = readMovieCSV
+	case "application/x-ndjson", "application/jsonl":
+		read = readMovieNDJSON
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "text/csv", "application/x-ndjson")
+		return
+	}
+
+	maxBytes := app.config.movies.importMaxBytes
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	movies := []*data.Movie{}
+	rowErrors := []importRowError{}
+
+	err := read(r.Body, func(line int, movie *data.Movie, v *validator.Validator) {
+		if movie != nil {
+			data.ValidateMovie(v, movie)
+		}
+		if !v.Valid() {
+			rowErrors = append(rowErrors, importRowError{Line: line, Errors: v.Errors})
+			return
+		}
+		movies = append(movies, movie)
+	})
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytes))
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	if len(movies) == 0 && len(rowErrors) == 0 {
+		app.badRequestResponse(w, r, errors.New("body must contain at least one movie"))
+		return
+	}
+
+	if mode == importModeAllOrNothing && len(rowErrors) > 0 {
+		app.failedImportResponse(w, r, rowErrors)
+		return
+	}
+
+	if len(movies) > 0 {
+		err = app.models.Movies.Import(app.contextGetOrganization(r).ID, app.contextGetUser(r).ID, movies)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"imported": len(movies), "skipped": len(rowErrors), "rows": rowErrors}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMovieCSV reads movies from CSV with a header row naming the title, year, runtime
+// and genres columns, in any order. The runtime is a number of minutes, and the genres
+// are separated by commas within their field. Rows with the wrong number of fields are
+// reported like invalid ones, but CSV which can't be parsed any further is an error.
+func readMovieCSV(r io.Reader, row importRowFunc) error {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		switch {
+		case errors.Is(err, io.EOF):
+			return errors.New("body must contain a header row")
+		default:
+			return csvError(err)
+		}
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.PermittedValue(name, "title", "year", "runtime", "genres") {
+			return fmt.Errorf("body contains unknown column %q", name)
+		}
+		if _, exists := columns[name]; exists {
+			return fmt.Errorf("body contains duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+	if len(columns) != 4 {
+		return errors.New("body must have title, year, runtime and genres columns")
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		v := validator.New()
+
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) && errors.Is(err, csv.ErrFieldCount) {
+			v.AddError("row", fmt.Sprintf("must have %d fields", len(header)))
+			row(parseError.StartLine, nil, v)
+			continue
+		}
+		if err != nil {
+			return csvError(err)
+		}
+
+		line, _ := cr.FieldPos(0)
+
+		movie := &data.Movie{Title: record[columns["title"]]}
+
+		if field := strings.TrimSpace(record[columns["year"]]); field != "" {
+			year, err := strconv.ParseInt(field, 10, 32)
+			if err != nil {
+				v.AddError("year", "must be an integer")
+			}
+			movie.Year = int32(year)
+		}
+
+		if field := strings.TrimSpace(record[columns["runtime"]]); field != "" {
+			runtime, err := strconv.ParseInt(field, 10, 32)
+			if err != nil {
+				v.AddError("runtime", "must be an integer number of minutes")
+			}
+			movie.Runtime = data.Runtime(runtime)
+		}
+
+		if field := strings.TrimSpace(record[columns["genres"]]); field != "" {
+			for _, genre := range strings.Split(field, ",") {
+				movie.Genres = append(movie.Genres, strings.TrimSpace(genre))
+			}
+		}
+
+		row(line, movie, v)
+	}
+}
+
+// csvError turns an error from the CSV reader into one for the client. Read errors, such
+// as the body being too large, are returned as they are.
+func csvError(err error) error {
+	var parseError *csv.ParseError
+	if errors.As(err, &parseError) {
+		return fmt.Errorf("body contains badly-formed CSV on line %d: %v", parseError.Line, parseError.Err)
+	}
+	return err
+}
+
+// readMovieNDJSON reads movies from JSON Lines, one object per line in the same form as
+// the body of createMovieHandler. Blank lines are skipped.
+func readMovieNDJSON(r io.Reader, row importRowFunc) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var input struct {
+			Title   string       `json:"title"`
+			Year    int32        `json:"year"`
+			Runtime data.Runtime `json:"runtime"`
+			Genres  []string     `json:"genres"`
+		}
+
+		v := validator.New()
+
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&input)
+		if err == nil && dec.More() {
+			err = errors.New("more than one value")
+		}
+		if err != nil {
+			var unmarshalTypeError *json.UnmarshalTypeError
+
+			switch {
+			case errors.Is(err, data.ErrInvalidRuntimeFormat):
+				v.AddError("runtime", `must be a string like "102 mins"`)
+			case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+				v.AddError(unmarshalTypeError.Field, "has the wrong type")
+			case strings.HasPrefix(err.Error(), "json: unknown field "):
+				v.AddError("row", "contains unknown key "+strings.TrimPrefix(err.Error(), "json: unknown field "))
+			default:
+				v.AddError("row", "must be a single JSON object")
+			}
+
+			row(line, nil, v)
+			continue
+		}
+
+		row(line, &data.Movie{Title: input.Title, Year: input.Year, Runtime: input.Runtime, Genres: input.Genres}, v)
+	}
+
+	err := scanner.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("body must not contain lines longer than %d bytes", maxImportLine)
+	}
+	return err
+}
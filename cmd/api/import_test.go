@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestImportMovies(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	validCSV := "title,year,runtime,genres\nCasablanca,1942,102,\"drama,romance\"\nHeat,1995,170,crime\n"
+	invalidCSV := "title,year,runtime,genres\nCasablanca,1942,102,drama\n,1942,102,drama\nHeat,nineteen,170,crime\nToo,Many,Fields,In,Row\n"
+	validNDJSON := `{"title": "Casablanca", "year": 1942, "runtime": "102 mins", "genres": ["drama", "romance"]}` + "\n\n" +
+		`{"title": "Heat", "year": 1995, "runtime": "170 mins", "genres": ["crime"]}` + "\n"
+	invalidNDJSON := `{"title": "Casablanca", "year": 1942, "runtime": "102 mins", "genres": ["drama"]}` + "\n" +
+		`{"title": "Heat", "year": 1995, "runtime": 170, "genres": ["crime"]}` + "\n" +
+		`{"title": "Heat", "director": "Michael Mann"}` + "\n" +
+		`not json` + "\n"
+
+	tests := []struct {
+		name        string
+		urlPath     string
+		contentType string
+		body        string
+		wantCode    int
+		wantBody    string
+	}{
+		{name: "CSV", urlPath: "/v1/movies/import", contentType: "text/csv", body: validCSV, wantCode: http.StatusOK, wantBody: `"imported":2`},
+		{name: "CSV with charset", urlPath: "/v1/movies/import", contentType: "text/csv; charset=utf-8", body: validCSV, wantCode: http.StatusOK, wantBody: `"skipped":0`},
+		{name: "Reordered columns", urlPath: "/v1/movies/import", contentType: "text/csv", body: "Genres,Runtime,Year,Title\ncrime,170,1995,Heat\n", wantCode: http.StatusOK, wantBody: `"imported":1`},
+		{name: "NDJSON", urlPath: "/v1/movies/import", contentType: "application/x-ndjson", body: validNDJSON, wantCode: http.StatusOK, wantBody: `"imported":2`},
+		{name: "Invalid CSV rows", urlPath: "/v1/movies/import", contentType: "text/csv", body: invalidCSV, wantCode: http.StatusUnprocessableEntity, wantBody: `{"line":3,"errors":{"title":"must be provided"}}`},
+		{name: "Invalid CSV field", urlPath: "/v1/movies/import", contentType: "text/csv", body: invalidCSV, wantCode: http.StatusUnprocessableEntity, wantBody: `{"line":4,"errors":{"year":"must be an integer"}}`},
+		{name: "Wrong field count", urlPath: "/v1/movies/import", contentType: "text/csv", body: invalidCSV, wantCode: http.StatusUnprocessableEntity, wantBody: `{"line":5,"errors":{"row":"must have 4 fields"}}`},
+		{name: "Skip invalid CSV rows", urlPath: "/v1/movies/import?mode=skip_invalid", contentType: "text/csv", body: invalidCSV, wantCode: http.StatusOK, wantBody: `"imported":1,"rows":[{"line":3`},
+		{name: "Invalid NDJSON runtime", urlPath: "/v1/movies/import", contentType: "application/x-ndjson", body: invalidNDJSON, wantCode: http.StatusUnprocessableEntity, wantBody: `{"line":2,"errors":{"runtime":"must be a string like \"102 mins\""}}`},
+		{name: "Unknown NDJSON key", urlPath: "/v1/movies/import", contentType: "application/x-ndjson", body: invalidNDJSON, wantCode: http.StatusUnprocessableEntity, wantBody: `{"line":3,"errors":{"row":"contains unknown key \"director\""}}`},
+		{name: "Badly-formed NDJSON", urlPath: "/v1/movies/import", contentType: "application/x-ndjson", body: invalidNDJSON, wantCode: http.StatusUnprocessableEntity, wantBody: `{"line":4,"errors":{"row":"must be a single JSON object"}}`},
+		{name: "Skip invalid NDJSON rows", urlPath: "/v1/movies/import?mode=skip_invalid", contentType: "application/x-ndjson", body: invalidNDJSON, wantCode: http.StatusOK, wantBody: `"skipped":3`},
+		{name: "Everything skipped", urlPath: "/v1/movies/import?mode=skip_invalid", contentType: "text/csv", body: "title,year,runtime,genres\n,,,\n", wantCode: http.StatusOK, wantBody: `"imported":0`},
+		{name: "Invalid mode", urlPath: "/v1/movies/import?mode=best_effort", contentType: "text/csv", body: validCSV, wantCode: http.StatusUnprocessableEntity, wantBody: "must be one of all_or_nothing or skip_invalid"},
+		{name: "Unsupported type", urlPath: "/v1/movies/import", contentType: "application/json", body: `[]`, wantCode: http.StatusUnsupportedMediaType},
+		{name: "Empty CSV", urlPath: "/v1/movies/import", contentType: "text/csv", wantCode: http.StatusBadRequest, wantBody: "body must contain a header row"},
+		{name: "Header only", urlPath: "/v1/movies/import", contentType: "text/csv", body: "title,year,runtime,genres\n", wantCode: http.StatusBadRequest, wantBody: "body must contain at least one movie"},
+		{name: "Missing column", urlPath: "/v1/movies/import", contentType: "text/csv", body: "title,year,runtime\nHeat,1995,170\n", wantCode: http.StatusBadRequest, wantBody: "body must have title, year, runtime and genres columns"},
+		{name: "Unknown column", urlPath: "/v1/movies/import", contentType: "text/csv", body: "title,year,runtime,genres,director\n", wantCode: http.StatusBadRequest, wantBody: `body contains unknown column \"director\"`},
+		{name: "Duplicate column", urlPath: "/v1/movies/import", contentType: "text/csv", body: "title,year,runtime,title\n", wantCode: http.StatusBadRequest, wantBody: `body contains duplicate column \"title\"`},
+		{name: "Badly-formed CSV", urlPath: "/v1/movies/import", contentType: "text/csv", body: "title,year,runtime,genres\n\"Heat,1995,170,crime\n", wantCode: http.StatusBadRequest, wantBody: "body contains badly-formed CSV on line"},
+		{name: "Too large", urlPath: "/v1/movies/import", contentType: "text/csv", body: "title,year,runtime,genres\n" + strings.Repeat("Heat,1995,170,crime\n", 4000), wantCode: http.StatusBadRequest, wantBody: "body must not be larger than 65536 bytes"},
+		{name: "Movie ID", urlPath: "/v1/movies/1", contentType: "text/csv", body: validCSV, wantCode: http.StatusMethodNotAllowed},
+		{name: "Database fall", urlPath: "/v1/movies/import", contentType: "text/csv", body: "title,year,runtime,genres\nfall database,1995,170,crime\n", wantCode: http.StatusInternalServerError},
+		{name: "Fake json.Write", urlPath: "/v1/movies/import", contentType: "text/csv", body: validCSV, wantCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.doWithHeaders(t, http.MethodPost, tt.urlPath, []byte(tt.body), map[string]string{"Content-Type": tt.contentType})
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestCreateInvitation(t *testing.T) {
+	runAdminTests(t, http.MethodPost, []adminTestCase{
+		{
+			name:     "Valid request",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			body:     `{"email": "invited@example.com", "role": "viewer", "permissions": ["movies:write"], "max_uses": 1, "expiry": "2999-01-01T00:00:00Z"}`,
+			wantCode: http.StatusCreated,
+			wantBody: `"code":"InvitePlainTextForInviteTe"`,
+		},
+		{
+			name:     "Defaults",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			body:     `{}`,
+			wantCode: http.StatusCreated,
+			wantBody: `"max_uses":1`,
+		},
+		{
+			name:     "Not an admin",
+			token:    nonAdminToken,
+			urlPath:  "/v1/admin/invitations",
+			body:     `{}`,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Bad json",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			body:     `{"max_uses": "one"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Invalid email",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			body:     `{"email": "invited"}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Invalid max uses",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			body:     `{"max_uses": 0}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "must be at least 1",
+		},
+		{
+			name:     "Expiry in the past",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			body:     `{"expiry": "2000-01-01T00:00:00Z"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "must be in the future",
+		},
+		{
+			name:     "Unknown permission",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			body:     `{"permissions": ["movies:burn"]}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "is not a permission",
+		},
+		{
+			name:     "Unknown role",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			body:     `{"role": "unknown"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "does not exist",
+		},
+		{
+			name:     "Insert error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			body:     `{"max_uses": 13}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			body:     `{}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestListInvitations(t *testing.T) {
+	runAdminTests(t, http.MethodGet, []adminTestCase{
+		{
+			name:     "Valid request",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			wantCode: http.StatusOK,
+			wantBody: `"invitations"`,
+		},
+		{
+			name:     "Not an admin",
+			token:    nonAdminToken,
+			urlPath:  "/v1/admin/invitations",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations",
+			wantCode: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestDeleteInvitation(t *testing.T) {
+	runAdminTests(t, http.MethodDelete, []adminTestCase{
+		{
+			name:     "Valid request",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations/1",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Invalid id",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations/abc",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Not found",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations/3",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Delete error",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations/4",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    adminToken,
+			urlPath:  "/v1/admin/invitations/1",
+			wantCode: http.StatusInternalServerError,
+		},
+	})
+}
+
+func TestRegisterUserWithInvitation(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.registration.mode = registrationModeInvite
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid invitation",
+			body:     `{"name": "name", "email": "email@gmail.com", "password": "password", "invitation": "InvitePlainTextForInviteTe"}`,
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "Missing invitation",
+			body:     `{"name": "name", "email": "email@gmail.com", "password": "password"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "must be provided",
+		},
+		{
+			name:     "Invalid invitation",
+			body:     `{"name": "name", "email": "email@gmail.com", "password": "password", "invitation": "InvitePlainTextForInviteT1"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "invalid, expired or already used invitation code",
+		},
+		{
+			name:     "Duplicate email",
+			body:     `{"name": "name", "email": "taken@gmail.com", "password": "password", "invitation": "InvitePlainTextForInviteTe"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "a user with this email address already exists",
+		},
+		{
+			name:     "Redeem error",
+			body:     `{"name": "name", "email": "email@gmail.com", "password": "password", "invitation": "InvitePlainTextForInviteT2"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.postForm(t, "/v1/users", []byte(tt.body))
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"greenlight.bcc/internal/data"
+)
+
+// runJobs starts the periodic maintenance jobs. They run until done is closed, and are
+// tracked by app.wg so that shutdown waits for a run in progress to finish.
+func (app *application) runJobs(done <-chan struct{}) {
+	app.schedule(done, "purge deleted users", time.Hour, app.purgeDeletedUsers)
+	app.schedule(done, "purge deleted movies", time.Hour, app.purgeDeletedMovies)
+	app.schedule(done, "delete expired oidc login states", time.Hour, app.deleteExpiredLoginStates)
+}
+
+// schedule runs job straight away and then every interval until done is closed.
+func (app *application) schedule(done <-chan struct{}, name string, interval time.Duration, job func() error) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			app.runJob(name, job)
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (app *application) runJob(name string, job func() error) {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{"job": name})
+		}
+	}()
+
+	err := job()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"job": name})
+	}
+}
+
+func (app *application) purgeDeletedUsers() error {
+	purged, err := app.models.Users.PurgeDeleted(time.Now().Add(-app.config.users.deletionGracePeriod))
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		app.logger.PrintInfo("purged deleted users", map[string]string{
+			"count": strconv.FormatInt(purged, 10),
+		})
+	}
+
+	return nil
+}
+
+// purgeDeletedMovies removes movies which have been in the trash for longer than the
+// retention period, and then their images.
+func (app *application) purgeDeletedMovies() error {
+	movies, err := app.models.Movies.PurgeDeleted(time.Now().Add(-app.config.movies.trashRetention))
+
+	// Some organizations may have been purged before an error, and their movies' images
+	// still need deleting.
+	for _, movie := range movies {
+		if movie.Poster != nil {
+			app.deleteBlobs(movie.Poster.Keys(data.ImagePoster)...)
+		}
+		if movie.Backdrop != nil {
+			app.deleteBlobs(movie.Backdrop.Keys(data.ImageBackdrop)...)
+		}
+	}
+
+	if len(movies) > 0 {
+		app.logger.PrintInfo("purged deleted movies", map[string]string{
+			"count": strconv.Itoa(len(movies)),
+		})
+	}
+
+	return err
+}
+
+func (app *application) deleteExpiredLoginStates() error {
+	_, err := app.models.Identities.DeleteExpiredLoginStates()
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.bcc/internal/assert"
+	"greenlight.bcc/internal/blob"
+)
+
+func TestSchedule(t *testing.T) {
+	app := newTestApplication(t)
+
+	runs := make(chan struct{}, 10)
+	done := make(chan struct{})
+
+	// The first run panics and the rest fail, neither of which should stop the schedule.
+	panicked := false
+	app.schedule(done, "test", time.Millisecond, func() error {
+		runs <- struct{}{}
+		if !panicked {
+			panicked = true
+			panic("recovered")
+		}
+		return errors.New("logged")
+	})
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatal("job did not run")
+		}
+	}
+
+	close(done)
+	app.wg.Wait()
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	app := newTestApplication(t)
+
+	assert.NilError(t, app.purgeDeletedUsers())
+}
+
+func TestPurgeDeletedMovies(t *testing.T) {
+	app := newTestApplication(t)
+
+	key := "movies/6/poster-purged-w92.jpg"
+	err := app.blobs.Put(context.Background(), key, strings.NewReader("thumbnail"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NilError(t, app.purgeDeletedMovies())
+
+	_, err = app.blobs.Get(context.Background(), key)
+	assert.Equal(t, errors.Is(err, blob.ErrNotFound), true)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/jwt"
+)
+
+const (
+	authModeToken = "token"
+	authModeJWT   = "jwt"
+
+	jwtIssuer = "greenlight.bcc"
+)
+
+// accessClaims carries everything the authenticate and requirePermission middleware need,
+// so that a JWT access token can be checked without a database round trip.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Name        string   `json:"name"`
+	Activated   bool     `json:"activated"`
+	Permissions []string `json:"permissions"`
+	SessionID   int64    `json:"sid"`
+}
+
+func newJWTSigner(cfg config) (*jwt.Signer, error) {
+	switch cfg.jwt.alg {
+	case jwt.AlgHS256:
+		if len(cfg.jwt.secret) < 32 {
+			return nil, errors.New("jwt-secret must be at least 32 bytes long")
+		}
+		return jwt.NewHS256([]byte(cfg.jwt.secret)), nil
+	case jwt.AlgEdDSA:
+		key, err := base64.StdEncoding.DecodeString(cfg.jwt.ed25519Key)
+		if err != nil {
+			return nil, fmt.Errorf("jwt-ed25519-key: %w", err)
+		}
+		switch len(key) {
+		case ed25519.SeedSize:
+			return jwt.NewEdDSA(ed25519.NewKeyFromSeed(key)), nil
+		case ed25519.PrivateKeySize:
+			return jwt.NewEdDSA(ed25519.PrivateKey(key)), nil
+		default:
+			return nil, errors.New("jwt-ed25519-key must be a base64 encoded 32 byte seed or 64 byte private key")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported jwt-alg %q", cfg.jwt.alg)
+	}
+}
+
+// newJWTAccessToken signs an access token for user. The sessionID is the ID of the refresh
+// token issued alongside it, which is what gets revoked when the user logs out.
+func (app *application) newJWTAccessToken(user *data.User, sessionID int64) (*data.Token, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.signAccessToken(user, permissions, sessionID)
+}
+
+func (app *application) signAccessToken(user *data.User, permissions data.Permissions, sessionID int64) (*data.Token, error) {
+	now := time.Now()
+	expiry := now.Add(app.config.auth.accessTokenTTL)
+
+	claims := accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    jwtIssuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiry.Unix(),
+		},
+		Name:        user.Name,
+		Activated:   user.Activated,
+		Permissions: permissions,
+		SessionID:   sessionID,
+	}
+
+	plaintext, err := app.jwtSigner.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{
+		Plaintext: plaintext,
+		UserID:    user.ID,
+		Expiry:    expiry,
+		Scope:     data.ScopeAuthentication,
+	}, nil
+}
+
+func (app *application) parseJWTAccessToken(token string) (*accessClaims, error) {
+	var claims accessClaims
+
+	err := app.jwtSigner.Verify(token, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	err = claims.Valid(time.Now(), jwtIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+func (c *accessClaims) user() (*data.User, error) {
+	id, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil || id < 1 {
+		return nil, jwt.ErrInvalidToken
+	}
+
+	return &data.User{
+		ID:        id,
+		Name:      c.Name,
+		Activated: c.Activated,
+	}, nil
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+const listOwnerToken = "Bearer TokenPlainTextForTokenTest"
+
+func TestListLists(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/lists",
+			token:    listOwnerToken,
+			wantCode: http.StatusOK,
+			wantBody: `"lists":[]`,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/lists",
+			token:    brokenToken,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Anonymous",
+			urlPath:  "/v1/lists",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/lists",
+			token:    listOwnerToken,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.getForAuth(t, tt.urlPath, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCreateList(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Custom list",
+			urlPath:  "/v1/lists",
+			token:    listOwnerToken,
+			body:     `{"name": "Favourites", "public": true}`,
+			wantCode: http.StatusCreated,
+			wantBody: `"kind":"custom"`,
+		},
+		{
+			name:     "Watchlist",
+			urlPath:  "/v1/lists",
+			token:    listOwnerToken,
+			body:     `{"name": "To watch", "kind": "watchlist"}`,
+			wantCode: http.StatusCreated,
+			wantBody: `"slug":"mockslug"`,
+		},
+		{
+			name:     "Second watchlist",
+			urlPath:  "/v1/lists",
+			token:    listOwnerToken,
+			body:     `{"name": "Duplicate", "kind": "watchlist"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "you already have a watchlist list",
+		},
+		{
+			name:     "Invalid kind",
+			urlPath:  "/v1/lists",
+			token:    listOwnerToken,
+			body:     `{"name": "Favourites", "kind": "favourites"}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Missing name",
+			urlPath:  "/v1/lists",
+			token:    listOwnerToken,
+			body:     `{}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Bad json",
+			urlPath:  "/v1/lists",
+			token:    listOwnerToken,
+			body:     `{"name": 1}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/lists",
+			token:    listOwnerToken,
+			body:     `{"name": "fall"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/lists",
+			token:    listOwnerToken,
+			body:     `{"name": "Favourites"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.postForAuth(t, tt.urlPath, []byte(tt.body), tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestShowList(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/lists/1",
+			token:    listOwnerToken,
+			wantCode: http.StatusOK,
+			wantBody: `"title":"Test Mock"`,
+		},
+		{
+			name:     "Non-existent list",
+			urlPath:  "/v1/lists/3",
+			token:    listOwnerToken,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/v1/lists/string",
+			token:    listOwnerToken,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/lists/2",
+			token:    listOwnerToken,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Items fall",
+			urlPath:  "/v1/lists/5",
+			token:    listOwnerToken,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/lists/1",
+			token:    listOwnerToken,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.getForAuth(t, tt.urlPath, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestShowPublicList(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Anonymous",
+			urlPath:  "/v1/public-lists/public",
+			wantCode: http.StatusOK,
+			wantBody: `"position":1`,
+		},
+		{
+			name:     "Private or unknown",
+			urlPath:  "/v1/public-lists/private",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/public-lists/fall",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Items fall",
+			urlPath:  "/v1/public-lists/items-fall",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUpdateList(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/lists/1",
+			token:    listOwnerToken,
+			body:     `{"name": "Renamed", "public": true}`,
+			wantCode: http.StatusOK,
+			wantBody: `"version":2`,
+		},
+		{
+			name:     "Empty name",
+			urlPath:  "/v1/lists/1",
+			token:    listOwnerToken,
+			body:     `{"name": ""}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Bad json",
+			urlPath:  "/v1/lists/1",
+			token:    listOwnerToken,
+			body:     `{"public": "yes"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Edit conflict",
+			urlPath:  "/v1/lists/1",
+			token:    listOwnerToken,
+			body:     `{"name": "Conflict"}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/lists/1",
+			token:    listOwnerToken,
+			body:     `{"name": "fall"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Non-existent list",
+			urlPath:  "/v1/lists/3",
+			token:    listOwnerToken,
+			body:     `{"name": "Renamed"}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/lists/1",
+			token:    listOwnerToken,
+			body:     `{"name": "Renamed"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.patchForAuth(t, tt.urlPath, []byte(tt.body), tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDeleteList(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/lists/1",
+			token:    listOwnerToken,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Non-existent list",
+			urlPath:  "/v1/lists/3",
+			token:    listOwnerToken,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/v1/lists/string",
+			token:    listOwnerToken,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/lists/2",
+			token:    listOwnerToken,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/lists/1",
+			token:    listOwnerToken,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, _ := ts.deleteForAuth(t, tt.urlPath, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestSetListItem(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Add at the end",
+			urlPath:  "/v1/lists/1/movies/1",
+			token:    listOwnerToken,
+			body:     `{}`,
+			wantCode: http.StatusOK,
+			wantBody: `"position":1`,
+		},
+		{
+			name:     "Add at a position",
+			urlPath:  "/v1/lists/1/movies/1",
+			token:    listOwnerToken,
+			body:     `{"position": 3}`,
+			wantCode: http.StatusOK,
+			wantBody: `"position":3`,
+		},
+		{
+			name:     "Watched list",
+			urlPath:  "/v1/lists/4/movies/1",
+			token:    listOwnerToken,
+			body:     `{}`,
+			wantCode: http.StatusOK,
+			wantBody: `"watched_at":`,
+		},
+		{
+			name:     "Watched at",
+			urlPath:  "/v1/lists/1/movies/1",
+			token:    listOwnerToken,
+			body:     `{"watched_at": "2020-01-02T15:04:05Z"}`,
+			wantCode: http.StatusOK,
+			wantBody: `"watched_at":"2020-01-02T15:04:05Z"`,
+		},
+		{
+			name:     "Watched in the future",
+			urlPath:  "/v1/lists/1/movies/1",
+			token:    listOwnerToken,
+			body:     `{"watched_at": "2999-01-02T15:04:05Z"}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Negative position",
+			urlPath:  "/v1/lists/1/movies/1",
+			token:    listOwnerToken,
+			body:     `{"position": -1}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Bad json",
+			urlPath:  "/v1/lists/1/movies/1",
+			token:    listOwnerToken,
+			body:     `{"position": "first"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Non-existent movie",
+			urlPath:  "/v1/lists/1/movies/3",
+			token:    listOwnerToken,
+			body:     `{}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String movie ID",
+			urlPath:  "/v1/lists/1/movies/string",
+			token:    listOwnerToken,
+			body:     `{}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent list",
+			urlPath:  "/v1/lists/3/movies/1",
+			token:    listOwnerToken,
+			body:     `{}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/lists/1/movies/2",
+			token:    listOwnerToken,
+			body:     `{}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/lists/1/movies/1",
+			token:    listOwnerToken,
+			body:     `{}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.updateForAuth(t, tt.urlPath, []byte(tt.body), tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRemoveListItem(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/lists/1/movies/1",
+			token:    listOwnerToken,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Not on the list",
+			urlPath:  "/v1/lists/1/movies/3",
+			token:    listOwnerToken,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String movie ID",
+			urlPath:  "/v1/lists/1/movies/string",
+			token:    listOwnerToken,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent list",
+			urlPath:  "/v1/lists/3/movies/1",
+			token:    listOwnerToken,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/lists/1/movies/2",
+			token:    listOwnerToken,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/lists/1/movies/1",
+			token:    listOwnerToken,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, _ := ts.deleteForAuth(t, tt.urlPath, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"expvar"
 	"flag"
+	"fmt"
 	"os"
 	"runtime"
 	"strings"
@@ -12,9 +13,12 @@ import (
 	"time"
 
 	_ "github.com/lib/pq"
+	"greenlight.bcc/internal/blob"
 	"greenlight.bcc/internal/data"
 	"greenlight.bcc/internal/jsonlog"
+	"greenlight.bcc/internal/jwt"
 	"greenlight.bcc/internal/mailer" // New import
+	"greenlight.bcc/internal/oidc"
 )
 
 const version = "1.0.0"
@@ -43,14 +47,54 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	auth struct {
+		mode             string
+		accessTokenTTL   time.Duration
+		refreshTokenTTL  time.Duration
+		magicLinkEnabled bool
+	}
+	jwt struct {
+		alg        string
+		secret     string
+		ed25519Key string
+	}
+	lockout      data.LockoutPolicy
+	registration struct {
+		mode                string
+		defaultRole         string
+		defaultOrganization string
+	}
+	users struct {
+		deletionGracePeriod time.Duration
+	}
+	movies struct {
+		trashRetention time.Duration
+		importMaxBytes int64
+	}
+	reviews struct {
+		editWindow time.Duration
+	}
+	images struct {
+		dir          string
+		baseURL      string
+		maxBytes     int64
+		maxDimension int
+	}
+	oidc struct {
+		providers []oidc.Config
+	}
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config    config
+	logger    *jsonlog.Logger
+	models    data.Models
+	mailer    mailer.Mailer
+	blobs     blob.Store
+	jwtSigner *jwt.Signer
+	// oidcProviders are the identity providers users can log in with, keyed by name.
+	oidcProviders map[string]*oidc.Provider
+	wg            sync.WaitGroup
 }
 
 func main() {
@@ -75,6 +119,50 @@ func main() {
 	flag.StringVar(&cfg.smtp.password, "smtp-password", "d6db3cd88fa14c", "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@greenlight.alexedwards.net>", "SMTP sender")
 
+	flag.StringVar(&cfg.auth.mode, "auth-mode", authModeToken, "Authentication token mode (token|jwt)")
+	flag.DurationVar(&cfg.auth.accessTokenTTL, "auth-access-token-ttl", 15*time.Minute, "Lifetime of authentication (access) tokens")
+	flag.DurationVar(&cfg.auth.refreshTokenTTL, "auth-refresh-token-ttl", 30*24*time.Hour, "Lifetime of refresh tokens")
+	flag.BoolVar(&cfg.auth.magicLinkEnabled, "magic-link-enabled", true, "Allow passwordless login with emailed magic links")
+
+	flag.StringVar(&cfg.jwt.alg, "jwt-alg", jwt.AlgHS256, "JWT signing algorithm (HS256|EdDSA)")
+	flag.StringVar(&cfg.jwt.secret, "jwt-secret", os.Getenv("GREENLIGHT_JWT_SECRET"), "JWT HS256 secret")
+	flag.StringVar(&cfg.jwt.ed25519Key, "jwt-ed25519-key", os.Getenv("GREENLIGHT_JWT_ED25519_KEY"), "JWT EdDSA private key (base64 encoded seed)")
+
+	flag.IntVar(&cfg.lockout.MaxAttempts, "lockout-max-attempts", 5, "Failed logins for an email address before it is locked")
+	flag.DurationVar(&cfg.lockout.Window, "lockout-window", 15*time.Minute, "Window in which failed logins are counted")
+	flag.DurationVar(&cfg.lockout.Duration, "lockout-duration", time.Minute, "Duration of the first lockout, doubled for each one after")
+	flag.DurationVar(&cfg.lockout.MaxDuration, "lockout-max-duration", 24*time.Hour, "Maximum duration of a lockout")
+
+	flag.StringVar(&cfg.registration.mode, "registration-mode", registrationModeOpen, "Registration mode (open|invite)")
+	flag.StringVar(&cfg.registration.defaultRole, "default-role", "viewer", "Role given to newly registered users")
+	flag.StringVar(&cfg.registration.defaultOrganization, "default-organization", data.DefaultOrganizationSlug, "Organization newly registered users join as editors (empty for none)")
+
+	flag.DurationVar(&cfg.users.deletionGracePeriod, "user-deletion-grace-period", 30*24*time.Hour, "Time before a deleted account is permanently removed")
+
+	flag.DurationVar(&cfg.movies.trashRetention, "movie-trash-retention", 30*24*time.Hour, "Time a deleted movie stays in the trash before it is permanently removed")
+	flag.Int64Var(&cfg.movies.importMaxBytes, "movie-import-max-bytes", 10*1_048_576, "Maximum size of a movie import in bytes")
+
+	flag.DurationVar(&cfg.reviews.editWindow, "review-edit-window", 24*time.Hour, "Time after posting a review during which its author can edit it")
+
+	flag.StringVar(&cfg.images.dir, "image-dir", "./uploads", "Directory uploaded images are stored in")
+	flag.StringVar(&cfg.images.baseURL, "image-base-url", "/v1/images", "URL uploaded images are served from")
+	flag.Int64Var(&cfg.images.maxBytes, "image-max-bytes", 10*1_048_576, "Maximum size of an uploaded image in bytes")
+	flag.IntVar(&cfg.images.maxDimension, "image-max-dimension", 6000, "Maximum width and height of an uploaded image in pixels")
+
+	flag.Func("oidc-provider", "OpenID Connect provider as name=...,issuer=...,client-id=...,client-secret=...,redirect-url=... (repeatable)", func(val string) error {
+		provider, err := oidc.ParseConfig(val)
+		if err != nil {
+			return err
+		}
+		for _, p := range cfg.oidc.providers {
+			if p.Name == provider.Name {
+				return fmt.Errorf("oidc provider %s: configured more than once", p.Name)
+			}
+		}
+		cfg.oidc.providers = append(cfg.oidc.providers, provider)
+		return nil
+	})
+
 	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
 		cfg.cors.trustedOrigins = strings.Fields(val)
 		return nil
@@ -84,6 +172,28 @@ func main() {
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	var jwtSigner *jwt.Signer
+	switch cfg.auth.mode {
+	case authModeToken:
+	case authModeJWT:
+		var err error
+		jwtSigner, err = newJWTSigner(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	default:
+		logger.PrintFatal(fmt.Errorf("unsupported auth-mode %q", cfg.auth.mode), nil)
+	}
+
+	if cfg.registration.mode != registrationModeOpen && cfg.registration.mode != registrationModeInvite {
+		logger.PrintFatal(fmt.Errorf("unsupported registration-mode %q", cfg.registration.mode), nil)
+	}
+
+	blobs, err := blob.NewFileStore(cfg.images.dir, cfg.images.baseURL)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -107,11 +217,19 @@ func main() {
 		return time.Now().Unix()
 	}))
 
+	oidcProviders := make(map[string]*oidc.Provider, len(cfg.oidc.providers))
+	for _, provider := range cfg.oidc.providers {
+		oidcProviders[provider.Name] = oidc.New(provider, nil)
+	}
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:        cfg,
+		logger:        logger,
+		models:        data.NewModels(db),
+		mailer:        mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		blobs:         blobs,
+		jwtSigner:     jwtSigner,
+		oidcProviders: oidcProviders,
 	}
 
 	err = app.serve()
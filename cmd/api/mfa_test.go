@@ -0,0 +1,455 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"greenlight.bcc/internal/assert"
+	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/totp"
+)
+
+const (
+	mfaEnrolledToken = "Bearer TokenPlainTextForTokenTes7"
+	mfaPendingToken  = "Bearer TokenPlainTextForTokenTes8"
+)
+
+func TestEnrolTOTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid enrolment",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusCreated,
+			wantBody: `"uri":"otpauth://totp/Greenlight:test@test.com?`,
+		},
+		{
+			name:     "Restart pending enrolment",
+			token:    mfaPendingToken,
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "Already enabled",
+			token:    mfaEnrolledToken,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Anonymous",
+			token:    "",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Database error",
+			token:    "Bearer TokenPlainTextForTokenTes5",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				if tt.name == "Fake json.Write" {
+					storedMarshal := jsonMarshal
+					jsonMarshal = ts.fakeMarshal
+					defer ts.restoreMarshal(storedMarshal)
+				}
+
+				code, _, body := ts.postForAuth(t, "/v1/users/me/mfa/totp", nil, authHeader(t, app, tt.token))
+
+				assert.Equal(t, code, tt.wantCode)
+				if tt.wantBody != "" {
+					assert.StringContains(t, body, tt.wantBody)
+				}
+			})
+		}
+	}
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	validCode, err := totp.Code(data.MockTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleCode, err := totp.Code(data.MockTOTPSecret, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		Code     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid code",
+			token:    mfaPendingToken,
+			Code:     validCode,
+			wantCode: http.StatusOK,
+			wantBody: `"recovery_codes"`,
+		},
+		{
+			name:     "Stale code",
+			token:    mfaPendingToken,
+			Code:     staleCode,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Code is not digits",
+			token:    mfaPendingToken,
+			Code:     "abcdef",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Not enrolled",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			Code:     validCode,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Already enabled",
+			token:    mfaEnrolledToken,
+			Code:     validCode,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Database error",
+			token:    "Bearer TokenPlainTextForTokenTes5",
+			Code:     validCode,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    mfaPendingToken,
+			Code:     validCode,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				if tt.name == "Fake json.Write" {
+					storedMarshal := jsonMarshal
+					jsonMarshal = ts.fakeMarshal
+					defer ts.restoreMarshal(storedMarshal)
+				}
+
+				b, err := json.Marshal(map[string]string{"code": tt.Code})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				code, _, body := ts.updateForAuth(t, "/v1/users/me/mfa/totp", b, authHeader(t, app, tt.token))
+
+				assert.Equal(t, code, tt.wantCode)
+				if tt.wantBody != "" {
+					assert.StringContains(t, body, tt.wantBody)
+				}
+			})
+		}
+
+		code, _, _ := ts.updateForAuth(t, "/v1/users/me/mfa/totp", []byte("{"), authHeader(t, app, mfaPendingToken))
+
+		assert.Equal(t, code, http.StatusBadRequest)
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	validCode, err := totp.Code(data.MockTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		token        string
+		Code         string
+		RecoveryCode string
+		wantCode     int
+	}{
+		{
+			name:     "Valid code",
+			token:    mfaEnrolledToken,
+			Code:     validCode,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:         "Valid recovery code",
+			token:        mfaEnrolledToken,
+			RecoveryCode: "AAAAA-BBBBB",
+			wantCode:     http.StatusOK,
+		},
+		{
+			name:         "Unknown recovery code",
+			token:        mfaEnrolledToken,
+			RecoveryCode: "AAAAA-CCCCC",
+			wantCode:     http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Missing code",
+			token:    mfaEnrolledToken,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Code and recovery code",
+			token:        mfaEnrolledToken,
+			Code:         validCode,
+			RecoveryCode: "AAAAA-BBBBB",
+			wantCode:     http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Abandon pending enrolment",
+			token:    mfaPendingToken,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Not enrolled",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			Code:     validCode,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database error",
+			token:    "Bearer TokenPlainTextForTokenTes5",
+			Code:     validCode,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    mfaPendingToken,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				if tt.name == "Fake json.Write" {
+					storedMarshal := jsonMarshal
+					jsonMarshal = ts.fakeMarshal
+					defer ts.restoreMarshal(storedMarshal)
+				}
+
+				b, err := json.Marshal(map[string]string{"code": tt.Code, "recovery_code": tt.RecoveryCode})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				code, _, _ := ts.deleteWithBodyForAuth(t, "/v1/users/me/mfa/totp", b, authHeader(t, app, tt.token))
+
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+	}
+}
+
+func TestCreateMFAAuthenticationToken(t *testing.T) {
+	validCode, err := totp.Code(data.MockTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleCode, err := totp.Code(data.MockTOTPSecret, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const mfaToken = "TokenPlainTextForTokenTes7"
+
+	tests := []struct {
+		name         string
+		MFAToken     string
+		Code         string
+		RecoveryCode string
+		wantCode     int
+		wantBody     string
+	}{
+		{
+			name:     "Valid code",
+			MFAToken: mfaToken,
+			Code:     validCode,
+			wantCode: http.StatusCreated,
+			wantBody: `"refresh_token"`,
+		},
+		{
+			name:         "Valid recovery code",
+			MFAToken:     mfaToken,
+			RecoveryCode: "aaaaa-bbbbb",
+			wantCode:     http.StatusCreated,
+		},
+		{
+			name:     "Stale code",
+			MFAToken: mfaToken,
+			Code:     staleCode,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Unknown recovery code",
+			MFAToken:     mfaToken,
+			RecoveryCode: "AAAAA-CCCCC",
+			wantCode:     http.StatusUnauthorized,
+		},
+		{
+			name:     "User no longer enrolled",
+			MFAToken: "TokenPlainTextForTokenTest",
+			Code:     validCode,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Unknown MFA token",
+			MFAToken: "TokenPlainTextForTokenTes1",
+			Code:     validCode,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Invalid MFA token",
+			MFAToken: "wasd",
+			Code:     validCode,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Missing code",
+			MFAToken: mfaToken,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Database error",
+			MFAToken: "TokenPlainTextForTokenTes2",
+			Code:     validCode,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "TOTP error",
+			MFAToken: "TokenPlainTextForTokenTes5",
+			Code:     validCode,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			MFAToken: mfaToken,
+			Code:     validCode,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				if tt.name == "Fake json.Write" {
+					storedMarshal := jsonMarshal
+					jsonMarshal = ts.fakeMarshal
+					defer ts.restoreMarshal(storedMarshal)
+				}
+
+				b, err := json.Marshal(map[string]string{
+					"mfa_token":     tt.MFAToken,
+					"code":          tt.Code,
+					"recovery_code": tt.RecoveryCode,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				code, _, body := ts.postForm(t, "/v1/tokens/authentication/mfa", b)
+
+				assert.Equal(t, code, tt.wantCode)
+				if tt.wantBody != "" {
+					assert.StringContains(t, body, tt.wantBody)
+				}
+			})
+		}
+
+		code, _, _ := ts.postForm(t, "/v1/tokens/authentication/mfa", []byte{})
+
+		assert.Equal(t, code, http.StatusBadRequest)
+	}
+}
+
+// countingThrottleModel keeps the failures it is told about, so that tests can run into a
+// lockout.
+type countingThrottleModel struct {
+	data.MockLoginThrottleModel
+	throttles map[string]*data.LoginThrottle
+}
+
+func (m *countingThrottleModel) Get(email string) (*data.LoginThrottle, error) {
+	throttle, ok := m.throttles[email]
+	if !ok {
+		return &data.LoginThrottle{Email: email}, nil
+	}
+	return throttle, nil
+}
+
+func (m *countingThrottleModel) RecordFailure(email string, policy data.LockoutPolicy) (*data.LoginThrottle, bool, error) {
+	throttle, _ := m.Get(email)
+	m.throttles[email] = throttle
+
+	throttle.FailedAttempts++
+	if throttle.FailedAttempts < policy.MaxAttempts {
+		return throttle, false, nil
+	}
+
+	lockedUntil := time.Now().Add(policy.Duration)
+	throttle.LockedUntil = &lockedUntil
+	throttle.Lockouts++
+	return throttle, true, nil
+}
+
+func TestCreateMFAAuthenticationTokenLockout(t *testing.T) {
+	app := newTestApplication(t)
+	app.models.LoginThrottles = &countingThrottleModel{throttles: map[string]*data.LoginThrottle{}}
+
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	validCode, err := totp.Code(data.MockTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleCode, err := totp.Code(data.MockTOTPSecret, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each attempt stands for a fresh mfa token, got by logging in with the password again.
+	for i := 1; i < app.config.lockout.MaxAttempts; i++ {
+		code, _, _ := ts.postForm(t, "/v1/tokens/authentication/mfa", []byte(`{"mfa_token": "TokenPlainTextForTokenTes7", "code": "`+staleCode+`"}`))
+		assert.Equal(t, code, http.StatusUnauthorized)
+	}
+
+	code, header, _ := ts.postForm(t, "/v1/tokens/authentication/mfa", []byte(`{"mfa_token": "TokenPlainTextForTokenTes7", "code": "`+staleCode+`"}`))
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.Equal(t, header.Get("Retry-After") != "", true)
+
+	// Once locked, not even the right code gets in.
+	code, _, _ = ts.postForm(t, "/v1/tokens/authentication/mfa", []byte(`{"mfa_token": "TokenPlainTextForTokenTes7", "code": "`+validCode+`"}`))
+	assert.Equal(t, code, http.StatusTooManyRequests)
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/felixge/httpsnoop"
+	"github.com/julienschmidt/httprouter"
 	"golang.org/x/time/rate"
 	"greenlight.bcc/internal/data"
 	"greenlight.bcc/internal/validator"
@@ -22,6 +23,12 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		defer func() {
 
 			if err := recover(); err != nil {
+				// Handlers which have already started streaming a response abort it
+				// with http.ErrAbortHandler. The server drops the connection for them,
+				// which is the only way left to tell the client it is incomplete.
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
 
 				w.Header().Set("Connection", "close")
 
@@ -95,6 +102,11 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) == 2 && headerParts[0] == "ApiKey" {
+			app.authenticateAPIKey(w, r, headerParts[1], next)
+			return
+		}
+
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
@@ -102,6 +114,30 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		token := headerParts[1]
 
+		// A JWT is checked without the database, so like any other revocation a suspension
+		// only reaches it when it expires and can't be refreshed.
+		if app.config.auth.mode == authModeJWT {
+			claims, err := app.parseJWTAccessToken(token)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			user, err := claims.user()
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetToken(r, token)
+			r = app.contextSetPermissions(r, claims.Permissions)
+			r = app.contextSetAuthMethod(r, authMethodSession)
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		v := validator.New()
 		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
 			app.invalidAuthenticationTokenResponse(w, r)
@@ -119,12 +155,93 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// Suspending a user deletes their tokens, but a token which was being used at the
+		// time could still have been read.
+		if user.IsSuspended() {
+			app.accountSuspendedResponse(w, r)
+			return
+		}
+
+		err = app.models.Tokens.UpdateLastUsed(data.ScopeAuthentication, token)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
+		r = app.contextSetAuthMethod(r, authMethodSession)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// authenticateAPIKey authenticates a request made with an "Authorization: ApiKey" header.
+// The request is limited to the permissions granted to the key which the user still holds.
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, keyPlaintext string, next http.Handler) {
+	v := validator.New()
+	if data.ValidateAPIKeyPlaintext(v, keyPlaintext); !v.Valid() {
+		app.invalidAPIKeyResponse(w, r)
+		return
+	}
+
+	key, err := app.models.APIKeys.GetForPlaintext(keyPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAPIKeyResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.Get(key.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAPIKeyResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.IsSuspended() {
+		app.accountSuspendedResponse(w, r)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.APIKeys.UpdateLastUsed(key.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetPermissions(r, key.Permissions.Intersect(permissions))
+	r = app.contextSetAuthMethod(r, authMethodAPIKey)
+
+	next.ServeHTTP(w, r)
+}
+
+// userPermissions returns the permissions in effect for the request, preferring those
+// carried by the credentials over the ones stored for the user.
+func (app *application) userPermissions(r *http.Request, user *data.User) (data.Permissions, error) {
+	permissions, ok := app.contextGetPermissions(r)
+	if ok {
+		return permissions, nil
+	}
+
+	return app.models.Permissions.GetAllForUser(user.ID)
+}
+
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
@@ -136,6 +253,19 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 }
 
+// requireSessionAuth refuses requests authenticated with an API key. It guards the routes
+// which manage the account itself, so that a leaked key can't be used to take the
+// account over or to mint more keys.
+func (app *application) requireSessionAuth(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetAuthMethod(r) == authMethodAPIKey {
+			app.sessionRequiredResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
 
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -155,7 +285,7 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.userPermissions(r, user)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -171,6 +301,61 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 }
 
+// organization looks up the organization the request is for, along with the user's role
+// in it. It is named by the slug URL parameter on /v1/orgs/:slug routes and otherwise by
+// the X-Organization header, falling back to the default organization. Anonymous users
+// aren't members of anything, but as before organizations existed they can see the default
+// organization where a route lets them.
+func (app *application) organization(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "X-Organization")
+
+		slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+		if slug == "" {
+			slug = r.Header.Get("X-Organization")
+		}
+		if slug == "" {
+			slug = data.DefaultOrganizationSlug
+		}
+
+		user := app.contextGetUser(r)
+
+		org, err := app.models.Organizations.GetForUser(slug, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.organizationNotFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// Organizations the user doesn't belong to look the same as ones that don't exist.
+		if org.Role == "" && !(user.IsAnonymous() && org.Slug == data.DefaultOrganizationSlug) {
+			app.organizationNotFoundResponse(w, r)
+			return
+		}
+
+		r = app.contextSetOrganization(r, org)
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireOrganizationRole checks that the user has at least role in the organization the
+// request is for.
+func (app *application) requireOrganizationRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return app.organization(func(w http.ResponseWriter, r *http.Request) {
+		org := app.contextGetOrganization(r)
+
+		if !org.HasRole(role) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Origin")
@@ -185,7 +370,7 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Organization")
 
 						w.WriteHeader(http.StatusOK)
 						return
@@ -47,6 +47,26 @@ func TestRecoverPanicMiddleware(t *testing.T) {
 	}
 }
 
+func TestRecoverPanicMiddlewareAbort(t *testing.T) {
+	app := newTestApplication(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	recorder := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		assert.Equal(t, recover() == http.ErrAbortHandler, true)
+		assert.Equal(t, recorder.Body.Len(), 0)
+	}()
+
+	app.recoverPanic(handler).ServeHTTP(recorder, req)
+
+	t.Fatal("http.ErrAbortHandler was recovered")
+}
+
 func TestRateLimitMiddleware(t *testing.T) {
 	app := newTestApplication(t)
 
@@ -67,20 +87,17 @@ func TestRateLimitMiddleware(t *testing.T) {
 }
 
 func TestAuthenticateMiddleware(t *testing.T) {
-	app := newTestApplication(t)
-	ts := newTestServer(t, app.routesMiddlewareTest())
-	defer ts.Close()
-
 	// update movie fields
 	tests := []struct {
-		name     string
-		url      string
-		wantCode int
-		token    string
-		Title    string   `json:"title"`
-		Year     int32    `json:"year"`
-		Genres   []string `json:"genres"`
-		Runtime  string   `json:"runtime"`
+		name          string
+		url           string
+		wantCode      int
+		token         string
+		tokenModeOnly bool
+		Title         string   `json:"title"`
+		Year          int32    `json:"year"`
+		Genres        []string `json:"genres"`
+		Runtime       string   `json:"runtime"`
 	}{
 		{
 			name:     "Anonym",
@@ -105,6 +122,21 @@ func TestAuthenticateMiddleware(t *testing.T) {
 			token:    "Bearer wasd",
 			Title:    "Updated Title",
 			Runtime:  "105 mins",
+		}, {
+			name:     "Unknown Token",
+			url:      "/v1/movies/1",
+			wantCode: http.StatusUnauthorized,
+			token:    "Bearer TokenPlainTextForTokenTes1",
+			Title:    "Updated Title",
+			Runtime:  "105 mins",
+		}, {
+			name:          "Last used update fails",
+			url:           "/v1/movies/1",
+			wantCode:      http.StatusInternalServerError,
+			token:         "Bearer TokenPlainTextForTokenTes6",
+			tokenModeOnly: true,
+			Title:         "Updated Title",
+			Runtime:       "105 mins",
 		}, {
 			name:     "OK Token",
 			url:      "/v1/movies/1",
@@ -115,28 +147,191 @@ func TestAuthenticateMiddleware(t *testing.T) {
 		},
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			inputData := struct {
-				Title   string   `json:"title,omitempty"`
-				Year    int32    `json:"year,omitempty"`
-				Runtime string   `json:"runtime,omitempty"`
-				Genres  []string `json:"genres,omitempty"`
-			}{
-				Title:   tt.Title,
-				Year:    tt.Year,
-				Genres:  tt.Genres,
-				Runtime: tt.Runtime,
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesMiddlewareTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			if tt.tokenModeOnly && mode != authModeToken {
+				continue
+			}
+
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				inputData := struct {
+					Title   string   `json:"title,omitempty"`
+					Year    int32    `json:"year,omitempty"`
+					Runtime string   `json:"runtime,omitempty"`
+					Genres  []string `json:"genres,omitempty"`
+				}{
+					Title:   tt.Title,
+					Year:    tt.Year,
+					Genres:  tt.Genres,
+					Runtime: tt.Runtime,
+				}
+
+				b, err := json.Marshal(&inputData)
+				if err != nil {
+					t.Fatal("wrong input data")
+				}
+
+				code, _, _ := ts.patchForAuth(t, tt.url, b, authHeader(t, app, tt.token))
+
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+	}
+}
+
+func TestRequirePermissionMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		token         string
+		tokenModeOnly bool
+		wantCode      int
+	}{
+		{
+			name:     "Permitted",
+			method:   http.MethodGet,
+			url:      "/v1/movies/1",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Not permitted",
+			method:   http.MethodDelete,
+			url:      "/v1/movies/1",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Anonymous",
+			method:   http.MethodGet,
+			url:      "/v1/movies/1",
+			token:    "",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "API key",
+			method:   http.MethodGet,
+			url:      "/v1/movies/1",
+			token:    "ApiKey APIKeyPlainTextForAPIKeyTestAPIKeyPlainTextForAPIKeT",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "API key limited to permissions the user holds",
+			method:   http.MethodDelete,
+			url:      "/v1/movies/1",
+			token:    "ApiKey APIKeyPlainTextForAPIKeyTestAPIKeyPlainTextForAPIKeT",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Invalid API key",
+			method:   http.MethodGet,
+			url:      "/v1/movies/1",
+			token:    "ApiKey wasd",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Unknown API key",
+			method:   http.MethodGet,
+			url:      "/v1/movies/1",
+			token:    "ApiKey APIKeyPlainTextForAPIKeyTestAPIKeyPlainTextForAPIKe1",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "API key database fall",
+			method:   http.MethodGet,
+			url:      "/v1/movies/1",
+			token:    "ApiKey APIKeyPlainTextForAPIKeyTestAPIKeyPlainTextForAPIKe2",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "API key last used update fails",
+			method:   http.MethodGet,
+			url:      "/v1/movies/1",
+			token:    "ApiKey APIKeyPlainTextForAPIKeyTestAPIKeyPlainTextForAPIKe3",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:          "Permissions database fall",
+			method:        http.MethodGet,
+			url:           "/v1/movies/1",
+			token:         "Bearer TokenPlainTextForTokenTes5",
+			tokenModeOnly: true,
+			wantCode:      http.StatusInternalServerError,
+		},
+	}
+
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesMiddlewareTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			if tt.tokenModeOnly && mode != authModeToken {
+				continue
 			}
 
-			b, err := json.Marshal(&inputData)
-			if err != nil {
-				t.Fatal("wrong input data")
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				var code int
+				switch tt.method {
+				case http.MethodDelete:
+					code, _, _ = ts.deleteForAuth(t, tt.url, authHeader(t, app, tt.token))
+				default:
+					code, _, _ = ts.getForAuth(t, tt.url, authHeader(t, app, tt.token))
+				}
+
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+	}
+}
+
+func TestRequireSessionAuth(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	const apiKey = "ApiKey APIKeyPlainTextForAPIKeyTestAPIKeyPlainTextForAPIKeT"
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		token    string
+		wantCode int
+	}{
+		{name: "Update account", method: http.MethodPatch, url: "/v1/users/me", body: `{"email": "attacker@example.com"}`, token: apiKey, wantCode: http.StatusForbidden},
+		{name: "Delete account", method: http.MethodDelete, url: "/v1/users/me", body: `{"password": "pa55word"}`, token: apiKey, wantCode: http.StatusForbidden},
+		{name: "Export account", method: http.MethodGet, url: "/v1/users/me/export", token: apiKey, wantCode: http.StatusForbidden},
+		{name: "Change password", method: http.MethodPut, url: "/v1/users/me/password", body: `{"current_password": "pa55word", "new_password": "NewPassword"}`, token: apiKey, wantCode: http.StatusForbidden},
+		{name: "List sessions", method: http.MethodGet, url: "/v1/users/me/sessions", token: apiKey, wantCode: http.StatusForbidden},
+		{name: "Revoke session", method: http.MethodDelete, url: "/v1/users/me/sessions/1", token: apiKey, wantCode: http.StatusForbidden},
+		{name: "List API keys", method: http.MethodGet, url: "/v1/users/me/api-keys", token: apiKey, wantCode: http.StatusForbidden},
+		{name: "Create API key", method: http.MethodPost, url: "/v1/users/me/api-keys", body: `{"name": "More", "permissions": ["movies:read"]}`, token: apiKey, wantCode: http.StatusForbidden},
+		{name: "Delete API key", method: http.MethodDelete, url: "/v1/users/me/api-keys/1", token: apiKey, wantCode: http.StatusForbidden},
+		{name: "Enrol TOTP", method: http.MethodPost, url: "/v1/users/me/mfa/totp", token: apiKey, wantCode: http.StatusForbidden},
+		{name: "Disable TOTP", method: http.MethodDelete, url: "/v1/users/me/mfa/totp", body: `{"code": "123456"}`, token: apiKey, wantCode: http.StatusForbidden},
+		{name: "Session", method: http.MethodGet, url: "/v1/users/me/api-keys", token: "Bearer TokenPlainTextForTokenTest", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			if tt.body != "" {
+				body = []byte(tt.body)
 			}
 
-			code, _, _ := ts.patchForAuth(t, tt.url, b, tt.token)
+			code, _, respBody := ts.doForAuth(t, tt.method, tt.url, body, tt.token)
 
 			assert.Equal(t, code, tt.wantCode)
+			if tt.wantCode == http.StatusForbidden {
+				assert.StringContains(t, respBody, "can't be accessed with an API key")
+			}
 		})
 	}
 }
@@ -50,6 +50,28 @@ func TestShowMovie(t *testing.T) {
 			urlPath:  "/v1/movies/2",
 			wantCode: http.StatusInternalServerError,
 		},
+		{
+			name:     "Include credits",
+			urlPath:  "/v1/movies/1?include=credits",
+			wantCode: http.StatusOK,
+			wantBody: `"credits":[{"id":1,"movie_id":1,"person_id":1,"name":"Test Person","role":"director"}]`,
+		},
+		{
+			name:     "Image URLs",
+			urlPath:  "/v1/movies/1",
+			wantCode: http.StatusOK,
+			wantBody: `"w185":"/v1/images/movies/1/poster-mock-w185.jpg"`,
+		},
+		{
+			name:     "Include unknown",
+			urlPath:  "/v1/movies/1?include=reviews",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Credits fall",
+			urlPath:  "/v1/movies/5?include=credits",
+			wantCode: http.StatusInternalServerError,
+		},
 		{
 			name:     "Fake json.Write",
 			urlPath:  "/v1/movies/1",
@@ -415,6 +437,38 @@ func TestListMovies(t *testing.T) {
 			urlPath:  "/v1/movies?page=-1",
 			wantCode: http.StatusUnprocessableEntity,
 		},
+		{
+			name:     "Sort and filter by rating",
+			urlPath:  "/v1/movies?sort=-rating&min_rating=7&min_rating_count=3",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Min rating too high",
+			urlPath:  "/v1/movies?min_rating=11",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "must not be more than 10",
+		},
+		{
+			name:     "Negative min rating count",
+			urlPath:  "/v1/movies?min_rating_count=-1",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Filter by person",
+			urlPath:  "/v1/movies?person_id=1&role=actor",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Invalid role",
+			urlPath:  "/v1/movies?person_id=1&role=producer",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Role without person",
+			urlPath:  "/v1/movies?role=actor",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "must only be given with person_id",
+		},
 		{
 			name:     "Database fall cause of sort by genres",
 			urlPath:  "/v1/movies?sort=title",
@@ -447,3 +501,431 @@ func TestListMovies(t *testing.T) {
 		})
 	}
 }
+
+func TestSetMovieRating(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid rating",
+			urlPath:  "/v1/movies/1/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			body:     `{"rating": 8}`,
+			wantCode: http.StatusOK,
+			wantBody: `"rating":8`,
+		},
+		{
+			name:     "Rating too low",
+			urlPath:  "/v1/movies/1/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			body:     `{"rating": 0}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "must be at least 1",
+		},
+		{
+			name:     "Rating too high",
+			urlPath:  "/v1/movies/1/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			body:     `{"rating": 11}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "must not be more than 10",
+		},
+		{
+			name:     "Bad json",
+			urlPath:  "/v1/movies/1/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			body:     `{"rating": "eight"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Non-existent movie",
+			urlPath:  "/v1/movies/3/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			body:     `{"rating": 8}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/v1/movies/string/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			body:     `{"rating": 8}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/movies/2/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			body:     `{"rating": 8}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Anonymous",
+			urlPath:  "/v1/movies/1/rating",
+			body:     `{"rating": 8}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/movies/1/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			body:     `{"rating": 8}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.updateForAuth(t, tt.urlPath, []byte(tt.body), tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDeleteMovieRating(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/movies/1/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Not rated",
+			urlPath:  "/v1/movies/3/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/v1/movies/string/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/movies/2/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Anonymous",
+			urlPath:  "/v1/movies/1/rating",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/movies/1/rating",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, _ := ts.deleteForAuth(t, tt.urlPath, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestListDeletedMovies(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/movies/trash",
+			wantCode: http.StatusOK,
+			wantBody: `"deleted_at":`,
+		},
+		{
+			name:     "Retention",
+			urlPath:  "/v1/movies/trash?sort=id",
+			wantCode: http.StatusOK,
+			wantBody: `"retention":"720h0m0s"`,
+		},
+		{
+			name:     "Invalid sort",
+			urlPath:  "/v1/movies/trash?sort=rating",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/movies/trash?sort=title",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/movies/trash",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRestoreMovie(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/movies/1/restore",
+			wantCode: http.StatusOK,
+			wantBody: `"title":"Test Mock"`,
+		},
+		{
+			name:     "Not in the trash",
+			urlPath:  "/v1/movies/3/restore",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/v1/movies/trash/restore",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/movies/2/restore",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/movies/1/restore",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.postForm(t, tt.urlPath, nil)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestShowMovieHistory(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/movies/1/history",
+			wantCode: http.StatusOK,
+			wantBody: `"changes":{"title":{"old":"Old Mock","new":"Test Mock"}}`,
+		},
+		{
+			name:     "By creation time",
+			urlPath:  "/v1/movies/1/history?sort=created_at",
+			wantCode: http.StatusOK,
+			wantBody: `"action":"update"`,
+		},
+		{
+			name:     "Invalid sort",
+			urlPath:  "/v1/movies/1/history?sort=title",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Movie in the trash",
+			urlPath:  "/v1/movies/6/history",
+			wantCode: http.StatusOK,
+			wantBody: `"revisions":[`,
+		},
+		{
+			name:     "Non-existent movie",
+			urlPath:  "/v1/movies/3/history",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Movie database fall",
+			urlPath:  "/v1/movies/2/history",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/v1/movies/string/history",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/movies/1/history?sort=version",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/movies/1/history",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRevertMovie(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/movies/1/revert/1",
+			wantCode: http.StatusOK,
+			wantBody: `"title":"Old Mock"`,
+		},
+		{
+			name:     "Unknown version",
+			urlPath:  "/v1/movies/1/revert/9",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String version",
+			urlPath:  "/v1/movies/1/revert/first",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Zero version",
+			urlPath:  "/v1/movies/1/revert/0",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent movie",
+			urlPath:  "/v1/movies/3/revert/1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Edit conflict",
+			urlPath:  "/v1/movies/1/revert/3",
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/movies/2/revert/1",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/movies/1/revert/1",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.postForm(t, tt.urlPath, nil)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/oidc"
+	"greenlight.bcc/internal/validator"
+)
+
+// oidcLoginTTL is how long a user has to log in at the identity provider and come back.
+const oidcLoginTTL = 10 * time.Minute
+
+func (app *application) createOIDCAuthorizationHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[httprouter.ParamsFromContext(r.Context()).ByName("provider")]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	state, err := app.models.Identities.NewLoginState(provider.Name, nonce, verifier, oidcLoginTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state.Plaintext, nonce, challenge)
+	if err != nil {
+		app.identityProviderErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"authorization_url": authURL, "state": state.Plaintext, "expiry": state.Expiry}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createOIDCAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		State string `json:"state"`
+		Code  string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateLoginState(v, input.State)
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	state, err := app.models.Identities.ConsumeLoginState(input.State)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidOIDCLoginResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The provider may have been removed from the configuration since the login started.
+	provider, ok := app.oidcProviders[state.Provider]
+	if !ok {
+		app.invalidOIDCLoginResponse(w, r)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), input.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrExchangeFailed), errors.Is(err, oidc.ErrInvalidIDToken):
+			app.invalidOIDCLoginResponse(w, r)
+		default:
+			app.identityProviderErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, ok := app.userForIdentity(w, r, provider.Name, claims)
+	if !ok {
+		return
+	}
+
+	app.beginSession(w, r, user)
+}
+
+// userForIdentity finds or creates the user for a successful login at an identity
+// provider. Someone coming back with a subject we already know is that user. Otherwise an
+// existing account with the same email address is linked only if the provider has
+// verified the address, so that nobody can take over an account by signing up at a
+// provider with someone else's email. If that fails it has already sent the response, and
+// returns false.
+func (app *application) userForIdentity(w http.ResponseWriter, r *http.Request, provider string, claims *oidc.Claims) (*data.User, bool) {
+	user, err := app.models.Identities.GetUser(provider, claims.Subject)
+	if err == nil {
+		// The address at the provider may since have changed, in which case it says
+		// nothing about the one we have.
+		if !strings.EqualFold(claims.Email, user.Email) {
+			return user, true
+		}
+		return user, app.activateVerifiedUser(w, r, user, claims)
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, claims.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	user, err = app.models.Users.GetByEmail(claims.Email)
+	switch {
+	case err == nil:
+		if !claims.EmailVerified {
+			v.AddError("email", "a user with this email address already exists, log in with your password instead")
+			app.failedValidationResponse(w, r, v.Errors)
+			return nil, false
+		}
+		if !app.activateVerifiedUser(w, r, user, claims) {
+			return nil, false
+		}
+	case errors.Is(err, data.ErrRecordNotFound):
+		// There is nowhere to give an invitation code here, so people have to register
+		// with one first and link the provider by logging in with a verified email.
+		if app.config.registration.mode == registrationModeInvite {
+			app.registrationClosedResponse(w, r)
+			return nil, false
+		}
+		user, err = app.registerOIDCUser(claims)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDuplicateEmail):
+				v.AddError("email", "a user with this email address already exists")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return nil, false
+		}
+	default:
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	err = app.models.Identities.Insert(&data.Identity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateIdentity):
+			// Another login for the same subject got there first.
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
+// activateVerifiedUser activates the user if the provider vouches for their email address,
+// which is all that an activation token proves. A suspended user is left as they are, to
+// be turned away by beginSession. If that fails it has already sent the response, and
+// returns false.
+func (app *application) activateVerifiedUser(w http.ResponseWriter, r *http.Request, user *data.User, claims *oidc.Claims) bool {
+	if user.Activated || user.IsSuspended() || !claims.EmailVerified {
+		return true
+	}
+
+	user.Activated = true
+
+	err := app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	return true
+}
+
+// registerOIDCUser creates an account for someone logging in at a provider for the first
+// time. It gets a random password, which can be replaced with the password reset flow.
+func (app *application) registerOIDCUser(claims *oidc.Claims) (*data.User, error) {
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+
+	user := &data.User{
+		Name:      name,
+		Email:     claims.Email,
+		Activated: claims.EmailVerified,
+	}
+
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = user.Password.Set(base64.RawURLEncoding.EncodeToString(randomBytes)[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.setUpNewUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Activated {
+		token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			return nil, err
+		}
+
+		app.background(func() {
+			data := map[string]any{
+				"activationToken": token.Plaintext,
+				"userID":          user.ID,
+			}
+
+			err := app.mailer.Send(user.Email, "user_welcome.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	return user, nil
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"greenlight.bcc/internal/assert"
+	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/jwt"
+	"greenlight.bcc/internal/oidc"
+)
+
+const testClientID = "greenlight"
+
+// fakeIdP is a minimal OpenID Connect provider. Its token endpoint answers each
+// authorization code with an ID token carrying the claims registered for that code.
+type fakeIdP struct {
+	*httptest.Server
+	signer *jwt.Signer
+	codes  map[string]map[string]any
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &fakeIdP{
+		signer: jwt.NewRS256(key, "test-key"),
+		codes:  make(map[string]map[string]any),
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, err := idp.signer.JWK()
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(jwt.JWKS{Keys: []jwt.JWK{jwk}})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := idp.codes[r.PostFormValue("code")]
+		if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("code_verifier") != "mock-code-verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		signer := idp.signer
+		if claims["sub"] == "rogue" {
+			rogue, _ := rsa.GenerateKey(rand.Reader, 2048)
+			signer = jwt.NewRS256(rogue, "rogue-key")
+		}
+
+		idToken, err := signer.Sign(claims)
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+	})
+
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+// claims returns valid ID token claims for the mock login state, with the given overrides.
+func (idp *fakeIdP) claims(overrides map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss":            idp.URL,
+		"aud":            testClientID,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"nonce":          data.MockOIDCNonce,
+		"email_verified": true,
+	}
+	for k, v := range overrides {
+		claims[k] = v
+	}
+	return claims
+}
+
+func newOIDCTestApplication(t *testing.T, idp *fakeIdP) *application {
+	app := newTestApplication(t)
+
+	app.oidcProviders = make(map[string]*oidc.Provider)
+	for _, name := range []string{"test", "fall"} {
+		app.oidcProviders[name] = oidc.New(oidc.Config{
+			Name:        name,
+			Issuer:      idp.URL,
+			ClientID:    testClientID,
+			RedirectURL: "http://localhost:3000/callback",
+			Scopes:      []string{"openid", "email"},
+		}, idp.Client())
+	}
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	app.oidcProviders["down"] = oidc.New(oidc.Config{Name: "down", Issuer: down.URL, ClientID: testClientID}, nil)
+
+	return app
+}
+
+func TestCreateOIDCAuthorization(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+
+	app := newOIDCTestApplication(t, idp)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		provider string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid provider",
+			provider: "test",
+			wantCode: http.StatusCreated,
+			wantBody: "code_challenge_method=S256",
+		},
+		{
+			name:     "Unknown provider",
+			provider: "unknown",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			provider: "fall",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Provider unreachable",
+			provider: "down",
+			wantCode: http.StatusBadGateway,
+		},
+		{
+			name:     "Fake json.Write",
+			provider: "test",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.postForm(t, "/v1/oidc/"+tt.provider+"/authorize", nil)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+				assert.StringContains(t, body, idp.URL+"/authorize?")
+				assert.StringContains(t, body, `"state":"StatePlainTextForStateTest"`)
+			}
+		})
+	}
+}
+
+func TestCreateOIDCAuthenticationToken(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+
+	codes := map[string]map[string]any{
+		"linked":           idp.claims(map[string]any{"sub": "linked", "email": "test@test.com"}),
+		"linked-other":     idp.claims(map[string]any{"sub": "linked", "email": "other@test.com"}),
+		"linked-mfa":       idp.claims(map[string]any{"sub": "linked-mfa", "email": "mfa@test.com"}),
+		"linked-conflict":  idp.claims(map[string]any{"sub": "linked-conflict", "email": "test@test.com"}),
+		"lookup-fall":      idp.claims(map[string]any{"sub": "lookup-fall", "email": "test@test.com"}),
+		"new-verified":     idp.claims(map[string]any{"sub": "new", "email": "newu1@idp.test", "name": "New User"}),
+		"new-unverified":   idp.claims(map[string]any{"sub": "new", "email": "newu1@idp.test", "email_verified": false}),
+		"new-duplicate":    idp.claims(map[string]any{"sub": "new", "email": "newu1@test.com"}),
+		"no-email":         idp.claims(map[string]any{"sub": "new"}),
+		"existing":         idp.claims(map[string]any{"sub": "new", "email": "user0@test.com"}),
+		"existing-inact":   idp.claims(map[string]any{"sub": "new", "email": "user6@test.com"}),
+		"existing-unverif": idp.claims(map[string]any{"sub": "new", "email": "user0@test.com", "email_verified": false}),
+		"email-fall":       idp.claims(map[string]any{"sub": "new", "email": "user2@test.com"}),
+		"insert-fall":      idp.claims(map[string]any{"sub": "insert-fall", "email": "user0@test.com"}),
+		"insert-duplicate": idp.claims(map[string]any{"sub": "insert-duplicate", "email": "user0@test.com"}),
+		"audience-array":   idp.claims(map[string]any{"sub": "linked", "email": "test@test.com", "aud": []string{"other", testClientID}}),
+		"wrong-audience":   idp.claims(map[string]any{"sub": "linked", "email": "test@test.com", "aud": "other"}),
+		"wrong-issuer":     idp.claims(map[string]any{"sub": "linked", "email": "test@test.com", "iss": "https://evil.test"}),
+		"wrong-nonce":      idp.claims(map[string]any{"sub": "linked", "email": "test@test.com", "nonce": "replayed"}),
+		"expired":          idp.claims(map[string]any{"sub": "linked", "email": "test@test.com", "exp": time.Now().Add(-time.Minute).Unix()}),
+		"no-subject":       idp.claims(map[string]any{"email": "test@test.com"}),
+		"rogue-key":        idp.claims(map[string]any{"sub": "rogue", "email": "test@test.com"}),
+	}
+	for code, claims := range codes {
+		idp.codes[code] = claims
+	}
+
+	app := newOIDCTestApplication(t, idp)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	const validState = "StatePlainTextForStateTest"
+
+	tests := []struct {
+		name     string
+		state    string
+		code     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Linked identity", state: validState, code: "linked", wantCode: http.StatusCreated, wantBody: `"authentication_token":`},
+		{name: "Linked identity with changed email", state: validState, code: "linked-other", wantCode: http.StatusCreated},
+		{name: "Linked identity with MFA", state: validState, code: "linked-mfa", wantCode: http.StatusAccepted, wantBody: `"mfa_token":`},
+		{name: "Activation edit conflict", state: validState, code: "linked-conflict", wantCode: http.StatusConflict},
+		{name: "Identity lookup fall", state: validState, code: "lookup-fall", wantCode: http.StatusInternalServerError},
+		{name: "New user with verified email", state: validState, code: "new-verified", wantCode: http.StatusCreated},
+		{name: "New user with unverified email", state: validState, code: "new-unverified", wantCode: http.StatusCreated},
+		{name: "New user with duplicate email", state: validState, code: "new-duplicate", wantCode: http.StatusUnprocessableEntity},
+		{name: "No email", state: validState, code: "no-email", wantCode: http.StatusUnprocessableEntity},
+		{name: "Link existing user", state: validState, code: "existing", wantCode: http.StatusCreated},
+		{name: "Link and activate existing user", state: validState, code: "existing-inact", wantCode: http.StatusCreated},
+		{name: "Unverified email of existing user", state: validState, code: "existing-unverif", wantCode: http.StatusUnprocessableEntity, wantBody: "log in with your password"},
+		{name: "Email lookup fall", state: validState, code: "email-fall", wantCode: http.StatusInternalServerError},
+		{name: "Identity insert fall", state: validState, code: "insert-fall", wantCode: http.StatusInternalServerError},
+		{name: "Identity linked concurrently", state: validState, code: "insert-duplicate", wantCode: http.StatusConflict},
+		{name: "Audience array", state: validState, code: "audience-array", wantCode: http.StatusCreated},
+		{name: "Wrong audience", state: validState, code: "wrong-audience", wantCode: http.StatusUnauthorized},
+		{name: "Wrong issuer", state: validState, code: "wrong-issuer", wantCode: http.StatusUnauthorized},
+		{name: "Wrong nonce", state: validState, code: "wrong-nonce", wantCode: http.StatusUnauthorized},
+		{name: "Expired ID token", state: validState, code: "expired", wantCode: http.StatusUnauthorized},
+		{name: "No subject", state: validState, code: "no-subject", wantCode: http.StatusUnauthorized},
+		{name: "Signed with unknown key", state: validState, code: "rogue-key", wantCode: http.StatusUnauthorized},
+		{name: "Code rejected by provider", state: validState, code: "unknown", wantCode: http.StatusUnauthorized},
+		{name: "Unknown state", state: "StatePlainTextForStateTes1", code: "linked", wantCode: http.StatusUnauthorized},
+		{name: "State database fall", state: "StatePlainTextForStateTes2", code: "linked", wantCode: http.StatusInternalServerError},
+		{name: "Provider removed", state: "StatePlainTextForStateTes3", code: "linked", wantCode: http.StatusUnauthorized},
+		{name: "Short state", state: "short", code: "linked", wantCode: http.StatusUnprocessableEntity},
+		{name: "Missing code", state: validState, code: "", wantCode: http.StatusUnprocessableEntity},
+		{name: "Fake json.Write", state: validState, code: "linked", wantCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			inputData := struct {
+				State string `json:"state"`
+				Code  string `json:"code"`
+			}{
+				State: tt.state,
+				Code:  tt.code,
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, _, body := ts.postForm(t, "/v1/tokens/authentication/oidc", b)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	code, _, _ := ts.postForm(t, "/v1/tokens/authentication/oidc", []byte{})
+
+	assert.Equal(t, code, http.StatusBadRequest)
+}
+
+func TestCreateOIDCAuthenticationTokenInviteOnly(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+
+	idp.codes["linked"] = idp.claims(map[string]any{"sub": "linked", "email": "test@test.com"})
+	idp.codes["existing"] = idp.claims(map[string]any{"sub": "new", "email": "user0@test.com"})
+	idp.codes["new-verified"] = idp.claims(map[string]any{"sub": "new", "email": "newu1@idp.test"})
+
+	app := newOIDCTestApplication(t, idp)
+	app.config.registration.mode = registrationModeInvite
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		code     string
+		wantCode int
+	}{
+		{name: "Linked identity", code: "linked", wantCode: http.StatusCreated},
+		{name: "Link existing user", code: "existing", wantCode: http.StatusCreated},
+		{name: "New user", code: "new-verified", wantCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := []byte(`{"state": "StatePlainTextForStateTest", "code": "` + tt.code + `"}`)
+
+			code, _, _ := ts.postForm(t, "/v1/tokens/authentication/oidc", b)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
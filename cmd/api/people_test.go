@@ -0,0 +1,489 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestListPeople(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/people?name=test&sort=-birth_year",
+			wantCode: http.StatusOK,
+			wantBody: `"people":[]`,
+		},
+		{
+			name:     "Invalid sort",
+			urlPath:  "/v1/people?sort=bio",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/people?sort=name",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/people",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCreatePerson(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/people",
+			body:     `{"name": "Test Person", "birth_year": 1970, "bio": "Directs things."}`,
+			wantCode: http.StatusCreated,
+			wantBody: `"birth_year":1970`,
+		},
+		{
+			name:     "Without birth year",
+			urlPath:  "/v1/people",
+			body:     `{"name": "Test Person"}`,
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "Missing name",
+			urlPath:  "/v1/people",
+			body:     `{"birth_year": 1970}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Born in the future",
+			urlPath:  "/v1/people",
+			body:     `{"name": "Test Person", "birth_year": 2999}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Bad json",
+			urlPath:  "/v1/people",
+			body:     `{"name": 1}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/people",
+			body:     `{"name": "fall"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/people",
+			body:     `{"name": "Test Person"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.postForm(t, tt.urlPath, []byte(tt.body))
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestShowPerson(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/people/1",
+			wantCode: http.StatusOK,
+			wantBody: `"name":"Test Person"`,
+		},
+		{
+			name:     "Non-existent person",
+			urlPath:  "/v1/people/3",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/v1/people/string",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/people/2",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/people/1",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUpdatePerson(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/people/1",
+			body:     `{"bio": "Directs things."}`,
+			wantCode: http.StatusOK,
+			wantBody: `"version":2`,
+		},
+		{
+			name:     "Clear birth year",
+			urlPath:  "/v1/people/1",
+			body:     `{"birth_year": 0}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Empty name",
+			urlPath:  "/v1/people/1",
+			body:     `{"name": ""}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Bad json",
+			urlPath:  "/v1/people/1",
+			body:     `{"birth_year": "1970"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Edit conflict",
+			urlPath:  "/v1/people/1",
+			body:     `{"name": "Conflict"}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/people/1",
+			body:     `{"name": "fall"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Non-existent person",
+			urlPath:  "/v1/people/3",
+			body:     `{"name": "Renamed"}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/people/1",
+			body:     `{"name": "Renamed"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.patchReq(t, tt.urlPath, []byte(tt.body))
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDeletePerson(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/people/1",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Non-existent person",
+			urlPath:  "/v1/people/3",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/v1/people/string",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/people/2",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/people/1",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, _ := ts.deleteReq(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestCreateCredit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Director",
+			urlPath:  "/v1/movies/1/credits",
+			body:     `{"person_id": 1, "role": "director"}`,
+			wantCode: http.StatusCreated,
+			wantBody: `"name":"Test Person"`,
+		},
+		{
+			name:     "Actor",
+			urlPath:  "/v1/movies/1/credits",
+			body:     `{"person_id": 1, "role": "actor", "character": "Narrator"}`,
+			wantCode: http.StatusCreated,
+			wantBody: `"character":"Narrator"`,
+		},
+		{
+			name:     "Character for a writer",
+			urlPath:  "/v1/movies/1/credits",
+			body:     `{"person_id": 1, "role": "writer", "character": "Narrator"}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Invalid role",
+			urlPath:  "/v1/movies/1/credits",
+			body:     `{"person_id": 1, "role": "producer"}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Missing person",
+			urlPath:  "/v1/movies/1/credits",
+			body:     `{"role": "director"}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Duplicate",
+			urlPath:  "/v1/movies/1/credits",
+			body:     `{"person_id": 1, "role": "actor", "character": "Duplicate"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "already has this credit",
+		},
+		{
+			name:     "Bad json",
+			urlPath:  "/v1/movies/1/credits",
+			body:     `{"person_id": "1"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Non-existent person",
+			urlPath:  "/v1/movies/1/credits",
+			body:     `{"person_id": 3, "role": "director"}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent movie",
+			urlPath:  "/v1/movies/3/credits",
+			body:     `{"person_id": 1, "role": "director"}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String movie ID",
+			urlPath:  "/v1/movies/string/credits",
+			body:     `{"person_id": 1, "role": "director"}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/movies/2/credits",
+			body:     `{"person_id": 1, "role": "director"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/movies/1/credits",
+			body:     `{"person_id": 1, "role": "director"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.postForm(t, tt.urlPath, []byte(tt.body))
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDeleteCredit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Valid request",
+			urlPath:  "/v1/movies/1/credits/1",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Non-existent credit",
+			urlPath:  "/v1/movies/1/credits/3",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String credit ID",
+			urlPath:  "/v1/movies/1/credits/string",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String movie ID",
+			urlPath:  "/v1/movies/string/credits/1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/movies/1/credits/2",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/movies/1/credits/1",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, _ := ts.deleteReq(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+const (
+	reviewerToken  = "Bearer TokenPlainTextForTokenTest"
+	moderatorToken = "Bearer TokenPlainTextForTokenTes0"
+	brokenToken    = "Bearer TokenPlainTextForTokenTes5"
+)
+
+type reviewTestCase struct {
+	name     string
+	method   string
+	urlPath  string
+	token    string
+	body     string
+	wantCode int
+	wantBody string
+}
+
+func runReviewTests(t *testing.T, tests []reviewTestCase) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			var body []byte
+			if tt.body != "" {
+				body = []byte(tt.body)
+			}
+
+			code, _, respBody := ts.doForAuth(t, tt.method, tt.urlPath, body, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, respBody, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestListMovieReviews(t *testing.T) {
+	runReviewTests(t, []reviewTestCase{
+		{name: "Valid request", method: http.MethodGet, urlPath: "/v1/movies/1/reviews", wantCode: http.StatusOK, wantBody: `"reviews":[]`},
+		{name: "As moderator", method: http.MethodGet, urlPath: "/v1/movies/1/reviews?sort=id", token: moderatorToken, wantCode: http.StatusOK},
+		{name: "Permissions fall", method: http.MethodGet, urlPath: "/v1/movies/1/reviews", token: brokenToken, wantCode: http.StatusInternalServerError},
+		{name: "Invalid sort", method: http.MethodGet, urlPath: "/v1/movies/1/reviews?sort=body", wantCode: http.StatusUnprocessableEntity},
+		{name: "Non-existent movie", method: http.MethodGet, urlPath: "/v1/movies/3/reviews", wantCode: http.StatusNotFound},
+		{name: "String ID", method: http.MethodGet, urlPath: "/v1/movies/string/reviews", wantCode: http.StatusNotFound},
+		{name: "Movie database fall", method: http.MethodGet, urlPath: "/v1/movies/2/reviews", wantCode: http.StatusInternalServerError},
+		{name: "Reviews database fall", method: http.MethodGet, urlPath: "/v1/movies/1/reviews?sort=created_at", wantCode: http.StatusInternalServerError},
+		{name: "Fake json.Write", method: http.MethodGet, urlPath: "/v1/movies/1/reviews", wantCode: http.StatusInternalServerError},
+	})
+}
+
+func TestCreateMovieReview(t *testing.T) {
+	runReviewTests(t, []reviewTestCase{
+		{name: "Valid request", method: http.MethodPost, urlPath: "/v1/movies/1/reviews", token: reviewerToken, body: `{"body": "Loved it"}`, wantCode: http.StatusCreated, wantBody: `"version":1`},
+		{name: "Empty body", method: http.MethodPost, urlPath: "/v1/movies/1/reviews", token: reviewerToken, body: `{"body": ""}`, wantCode: http.StatusUnprocessableEntity},
+		{name: "Bad json", method: http.MethodPost, urlPath: "/v1/movies/1/reviews", token: reviewerToken, body: `{"body": 1}`, wantCode: http.StatusBadRequest},
+		{name: "Already reviewed", method: http.MethodPost, urlPath: "/v1/movies/1/reviews", token: reviewerToken, body: `{"body": "Duplicate review"}`, wantCode: http.StatusUnprocessableEntity, wantBody: "already reviewed"},
+		{name: "Non-existent movie", method: http.MethodPost, urlPath: "/v1/movies/3/reviews", token: reviewerToken, body: `{"body": "Loved it"}`, wantCode: http.StatusNotFound},
+		{name: "String ID", method: http.MethodPost, urlPath: "/v1/movies/string/reviews", token: reviewerToken, body: `{"body": "Loved it"}`, wantCode: http.StatusNotFound},
+		{name: "Database fall", method: http.MethodPost, urlPath: "/v1/movies/2/reviews", token: reviewerToken, body: `{"body": "Loved it"}`, wantCode: http.StatusInternalServerError},
+		{name: "Anonymous", method: http.MethodPost, urlPath: "/v1/movies/1/reviews", body: `{"body": "Loved it"}`, wantCode: http.StatusUnauthorized},
+		{name: "Fake json.Write", method: http.MethodPost, urlPath: "/v1/movies/1/reviews", token: reviewerToken, body: `{"body": "Loved it"}`, wantCode: http.StatusInternalServerError},
+	})
+}
+
+func TestShowMovieReview(t *testing.T) {
+	runReviewTests(t, []reviewTestCase{
+		{name: "Valid request", method: http.MethodGet, urlPath: "/v1/movies/1/reviews/1", wantCode: http.StatusOK, wantBody: `"body":"Test review"`},
+		{name: "Hidden review", method: http.MethodGet, urlPath: "/v1/movies/1/reviews/6", token: reviewerToken, wantCode: http.StatusNotFound},
+		{name: "Hidden review as moderator", method: http.MethodGet, urlPath: "/v1/movies/1/reviews/6", token: moderatorToken, wantCode: http.StatusOK, wantBody: `"hidden":true`},
+		{name: "Hidden review permissions fall", method: http.MethodGet, urlPath: "/v1/movies/1/reviews/6", token: brokenToken, wantCode: http.StatusInternalServerError},
+		{name: "Non-existent review", method: http.MethodGet, urlPath: "/v1/movies/1/reviews/3", wantCode: http.StatusNotFound},
+		{name: "String review ID", method: http.MethodGet, urlPath: "/v1/movies/1/reviews/string", wantCode: http.StatusNotFound},
+		{name: "String movie ID", method: http.MethodGet, urlPath: "/v1/movies/string/reviews/1", wantCode: http.StatusNotFound},
+		{name: "Database fall", method: http.MethodGet, urlPath: "/v1/movies/1/reviews/2", wantCode: http.StatusInternalServerError},
+		{name: "Fake json.Write", method: http.MethodGet, urlPath: "/v1/movies/1/reviews/1", wantCode: http.StatusInternalServerError},
+	})
+}
+
+func TestUpdateMovieReview(t *testing.T) {
+	runReviewTests(t, []reviewTestCase{
+		{name: "Valid request", method: http.MethodPatch, urlPath: "/v1/movies/1/reviews/1", token: reviewerToken, body: `{"body": "Even better the second time"}`, wantCode: http.StatusOK, wantBody: `"version":2`},
+		{name: "Not the author", method: http.MethodPatch, urlPath: "/v1/movies/1/reviews/5", token: reviewerToken, body: `{"body": "Mine now"}`, wantCode: http.StatusForbidden},
+		{name: "Editing window closed", method: http.MethodPatch, urlPath: "/v1/movies/1/reviews/4", token: reviewerToken, body: `{"body": "Too late"}`, wantCode: http.StatusForbidden, wantBody: "within 24h0m0s"},
+		{name: "Empty body", method: http.MethodPatch, urlPath: "/v1/movies/1/reviews/1", token: reviewerToken, body: `{"body": ""}`, wantCode: http.StatusUnprocessableEntity},
+		{name: "Bad json", method: http.MethodPatch, urlPath: "/v1/movies/1/reviews/1", token: reviewerToken, body: `{"body": 1}`, wantCode: http.StatusBadRequest},
+		{name: "Edit conflict", method: http.MethodPatch, urlPath: "/v1/movies/1/reviews/1", token: reviewerToken, body: `{"body": "Conflict"}`, wantCode: http.StatusConflict},
+		{name: "Database fall", method: http.MethodPatch, urlPath: "/v1/movies/1/reviews/1", token: reviewerToken, body: `{"body": "fall"}`, wantCode: http.StatusInternalServerError},
+		{name: "Non-existent review", method: http.MethodPatch, urlPath: "/v1/movies/1/reviews/3", token: reviewerToken, body: `{"body": "Loved it"}`, wantCode: http.StatusNotFound},
+		{name: "Anonymous", method: http.MethodPatch, urlPath: "/v1/movies/1/reviews/1", body: `{"body": "Loved it"}`, wantCode: http.StatusUnauthorized},
+		{name: "Fake json.Write", method: http.MethodPatch, urlPath: "/v1/movies/1/reviews/1", token: reviewerToken, body: `{"body": "Loved it"}`, wantCode: http.StatusInternalServerError},
+	})
+}
+
+func TestDeleteMovieReview(t *testing.T) {
+	runReviewTests(t, []reviewTestCase{
+		{name: "By author", method: http.MethodDelete, urlPath: "/v1/movies/1/reviews/1", token: reviewerToken, wantCode: http.StatusOK},
+		{name: "By moderator", method: http.MethodDelete, urlPath: "/v1/movies/1/reviews/5", token: moderatorToken, wantCode: http.StatusOK},
+		{name: "By someone else", method: http.MethodDelete, urlPath: "/v1/movies/1/reviews/5", token: reviewerToken, wantCode: http.StatusForbidden},
+		{name: "Permissions fall", method: http.MethodDelete, urlPath: "/v1/movies/1/reviews/5", token: brokenToken, wantCode: http.StatusInternalServerError},
+		{name: "Non-existent review", method: http.MethodDelete, urlPath: "/v1/movies/1/reviews/3", token: reviewerToken, wantCode: http.StatusNotFound},
+		{name: "Database fall", method: http.MethodDelete, urlPath: "/v1/movies/1/reviews/7", token: moderatorToken, wantCode: http.StatusInternalServerError},
+		{name: "Anonymous", method: http.MethodDelete, urlPath: "/v1/movies/1/reviews/1", wantCode: http.StatusUnauthorized},
+		{name: "Fake json.Write", method: http.MethodDelete, urlPath: "/v1/movies/1/reviews/1", token: reviewerToken, wantCode: http.StatusInternalServerError},
+	})
+}
+
+func TestUpdateReviewHidden(t *testing.T) {
+	runReviewTests(t, []reviewTestCase{
+		{name: "Hide review", method: http.MethodPut, urlPath: "/v1/movies/1/reviews/1/hidden", token: moderatorToken, body: `{"hidden": true}`, wantCode: http.StatusOK, wantBody: `"hidden":true`},
+		{name: "Version unchanged", method: http.MethodPut, urlPath: "/v1/movies/1/reviews/1/hidden", token: moderatorToken, body: `{"hidden": true}`, wantCode: http.StatusOK, wantBody: `"version":1`},
+		{name: "Not a moderator", method: http.MethodPut, urlPath: "/v1/movies/1/reviews/1/hidden", token: reviewerToken, body: `{"hidden": true}`, wantCode: http.StatusForbidden},
+		{name: "Missing hidden", method: http.MethodPut, urlPath: "/v1/movies/1/reviews/1/hidden", token: moderatorToken, body: `{}`, wantCode: http.StatusUnprocessableEntity},
+		{name: "Bad json", method: http.MethodPut, urlPath: "/v1/movies/1/reviews/1/hidden", token: moderatorToken, body: `{"hidden": "yes"}`, wantCode: http.StatusBadRequest},
+		{name: "Deleted meanwhile", method: http.MethodPut, urlPath: "/v1/movies/1/reviews/5/hidden", token: moderatorToken, body: `{"hidden": true}`, wantCode: http.StatusNotFound},
+		{name: "Update fall", method: http.MethodPut, urlPath: "/v1/movies/1/reviews/7/hidden", token: moderatorToken, body: `{"hidden": true}`, wantCode: http.StatusInternalServerError},
+		{name: "Resolve reports fall", method: http.MethodPut, urlPath: "/v1/movies/1/reviews/6/hidden", token: moderatorToken, body: `{"hidden": false}`, wantCode: http.StatusInternalServerError},
+		{name: "Non-existent review", method: http.MethodPut, urlPath: "/v1/movies/1/reviews/3/hidden", token: moderatorToken, body: `{"hidden": true}`, wantCode: http.StatusNotFound},
+		{name: "Fake json.Write", method: http.MethodPut, urlPath: "/v1/movies/1/reviews/1/hidden", token: moderatorToken, body: `{"hidden": true}`, wantCode: http.StatusInternalServerError},
+	})
+}
+
+func TestReportReview(t *testing.T) {
+	runReviewTests(t, []reviewTestCase{
+		{name: "Valid request", method: http.MethodPost, urlPath: "/v1/movies/1/reviews/5/reports", token: reviewerToken, body: `{"reason": "Spoilers"}`, wantCode: http.StatusAccepted},
+		{name: "Own review", method: http.MethodPost, urlPath: "/v1/movies/1/reviews/1/reports", token: reviewerToken, body: `{"reason": "Spoilers"}`, wantCode: http.StatusUnprocessableEntity, wantBody: "your own review"},
+		{name: "Missing reason", method: http.MethodPost, urlPath: "/v1/movies/1/reviews/5/reports", token: reviewerToken, body: `{}`, wantCode: http.StatusUnprocessableEntity},
+		{name: "Bad json", method: http.MethodPost, urlPath: "/v1/movies/1/reviews/5/reports", token: reviewerToken, body: `{"reason": 1}`, wantCode: http.StatusBadRequest},
+		{name: "Hidden review", method: http.MethodPost, urlPath: "/v1/movies/1/reviews/6/reports", token: reviewerToken, body: `{"reason": "Spoilers"}`, wantCode: http.StatusNotFound},
+		{name: "Database fall", method: http.MethodPost, urlPath: "/v1/movies/1/reviews/5/reports", token: reviewerToken, body: `{"reason": "fall"}`, wantCode: http.StatusInternalServerError},
+		{name: "Anonymous", method: http.MethodPost, urlPath: "/v1/movies/1/reviews/5/reports", body: `{"reason": "Spoilers"}`, wantCode: http.StatusUnauthorized},
+		{name: "Fake json.Write", method: http.MethodPost, urlPath: "/v1/movies/1/reviews/5/reports", token: reviewerToken, body: `{"reason": "Spoilers"}`, wantCode: http.StatusInternalServerError},
+	})
+}
+
+func TestListReviewReports(t *testing.T) {
+	runReviewTests(t, []reviewTestCase{
+		{name: "Valid request", method: http.MethodGet, urlPath: "/v1/reviews/reports", token: moderatorToken, wantCode: http.StatusOK, wantBody: `"reports":[]`},
+		{name: "Not a moderator", method: http.MethodGet, urlPath: "/v1/reviews/reports", token: reviewerToken, wantCode: http.StatusForbidden},
+		{name: "Invalid page", method: http.MethodGet, urlPath: "/v1/reviews/reports?page=0", token: moderatorToken, wantCode: http.StatusUnprocessableEntity},
+		{name: "Database fall", method: http.MethodGet, urlPath: "/v1/reviews/reports?sort=created_at", token: moderatorToken, wantCode: http.StatusInternalServerError},
+		{name: "Fake json.Write", method: http.MethodGet, urlPath: "/v1/reviews/reports", token: moderatorToken, wantCode: http.StatusInternalServerError},
+	})
+}
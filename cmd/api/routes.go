@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"greenlight.bcc/internal/data"
 )
 
 func (app *application) routes() http.Handler {
@@ -16,16 +17,104 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.listMoviesHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.createMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", staticOr("id", "export",
+		app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.exportMoviesHandler)),
+		staticOr("id", "trash",
+			app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.listDeletedMoviesHandler)),
+			app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.showMovieHandler)),
+		),
+	))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.updateMovieHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.deleteMovieHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", staticOr("id", "import",
+		app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.importMoviesHandler)),
+		app.methodNotAllowedResponse,
+	))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.restoreMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/history", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.showMovieHistoryHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revert/:version", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.revertMovieHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/rating", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.setMovieRatingHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/rating", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.deleteMovieRatingHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/images/:kind", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.uploadMovieImageHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/images/:kind", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.deleteMovieImageHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/images/*key", app.serveImageHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.listMovieReviewsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.createMovieReviewHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews/:review_id", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.showMovieReviewHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id/reviews/:review_id", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.updateMovieReviewHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/reviews/:review_id", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.deleteMovieReviewHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews/:review_id/reports", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.reportReviewHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/reviews/:review_id/hidden", app.requirePermission("reviews:moderate", app.requireOrganizationRole(data.OrgRoleViewer, app.updateReviewHiddenHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/reviews/reports", app.requirePermission("reviews:moderate", app.requireOrganizationRole(data.OrgRoleViewer, app.listReviewReportsHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.createCreditHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/credits/:credit_id", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.deleteCreditHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.listPeopleHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.createPersonHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.showPersonHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.updatePersonHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.deletePersonHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.listListsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.createListHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.showListHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.updateListHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.deleteListHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/lists/:id/movies/:movie_id", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.setListItemHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/movies/:movie_id", app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.removeListItemHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/public-lists/:slug", app.showPublicListHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/orgs", app.requireActivatedUser(app.listOrganizationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/orgs", app.requireActivatedUser(app.createOrganizationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:slug/members", app.requireActivatedUser(app.requireOrganizationRole(data.OrgRoleViewer, app.listMembersHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/orgs/:slug/members/:id", app.requireActivatedUser(app.requireOrganizationRole(data.OrgRoleAdmin, app.setMemberHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/orgs/:slug/members/:id", app.requireActivatedUser(app.requireOrganizationRole(data.OrgRoleAdmin, app.removeMemberHandler)))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireActivatedUser(app.requireSessionAuth(app.updateCurrentUserHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireAuthenticatedUser(app.requireSessionAuth(app.deleteCurrentUserHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.requireAuthenticatedUser(app.requireSessionAuth(app.exportCurrentUserHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", app.requireActivatedUser(app.requireSessionAuth(app.changeCurrentUserPasswordHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireAuthenticatedUser(app.requireSessionAuth(app.listSessionsHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireAuthenticatedUser(app.requireSessionAuth(app.deleteSessionHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys", app.requireActivatedUser(app.requireSessionAuth(app.listAPIKeysHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys", app.requireActivatedUser(app.requireSessionAuth(app.createAPIKeyHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/api-keys/:id", app.requireActivatedUser(app.requireSessionAuth(app.deleteAPIKeyHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/mfa/totp", app.requireActivatedUser(app.requireSessionAuth(app.enrolTOTPHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/mfa/totp", app.requireActivatedUser(app.requireSessionAuth(app.confirmTOTPHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/mfa/totp", app.requireActivatedUser(app.requireSessionAuth(app.disableTOTPHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission("users:admin", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermission("users:admin", app.showUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.grantUserPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.revokeUserPermissionsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/suspended", app.requirePermission("users:admin", app.updateUserSuspendedHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/sessions", app.requirePermission("users:admin", app.deleteUserSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/lockout", app.requirePermission("users:admin", app.unlockUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/invitations", app.requirePermission("users:admin", app.listInvitationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/invitations", app.requirePermission("users:admin", app.createInvitationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/invitations/:id", app.requirePermission("users:admin", app.deleteInvitationHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication/mfa", app.createMFAAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication/magic", app.createMagicLinkAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication/oidc", app.createOIDCAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/magic-link", app.createMagicLinkTokenHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/oidc/:provider/authorize", app.createOIDCAuthorizationHandler)
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
@@ -40,16 +129,95 @@ func (app *application) routesTest() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.listMoviesHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.createMovieHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.showMovieHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.deleteMovieHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.updateMovieHandler)
+	router.Handler(http.MethodGet, "/v1/movies", app.authenticate(app.organization(app.listMoviesHandler)))
+	router.Handler(http.MethodPost, "/v1/movies", app.authenticate(app.organization(app.createMovieHandler)))
+	router.Handler(http.MethodGet, "/v1/movies/:id", app.authenticate(app.organization(staticOr("id", "export", app.exportMoviesHandler, staticOr("id", "trash", app.listDeletedMoviesHandler, app.showMovieHandler)))))
+	router.Handler(http.MethodDelete, "/v1/movies/:id", app.authenticate(app.organization(app.deleteMovieHandler)))
+	router.Handler(http.MethodPatch, "/v1/movies/:id", app.authenticate(app.organization(app.updateMovieHandler)))
+	router.Handler(http.MethodPost, "/v1/movies/:id", app.authenticate(app.organization(staticOr("id", "import", app.importMoviesHandler, app.methodNotAllowedResponse))))
+	router.Handler(http.MethodPost, "/v1/movies/:id/restore", app.authenticate(app.organization(app.restoreMovieHandler)))
+	router.Handler(http.MethodGet, "/v1/movies/:id/history", app.authenticate(app.organization(app.showMovieHistoryHandler)))
+	router.Handler(http.MethodPost, "/v1/movies/:id/revert/:version", app.authenticate(app.organization(app.revertMovieHandler)))
+	router.Handler(http.MethodPut, "/v1/movies/:id/rating", app.authenticate(app.organization(app.requireActivatedUser(app.setMovieRatingHandler))))
+	router.Handler(http.MethodDelete, "/v1/movies/:id/rating", app.authenticate(app.organization(app.requireActivatedUser(app.deleteMovieRatingHandler))))
+	router.Handler(http.MethodPut, "/v1/movies/:id/images/:kind", app.authenticate(app.organization(app.uploadMovieImageHandler)))
+	router.Handler(http.MethodDelete, "/v1/movies/:id/images/:kind", app.authenticate(app.organization(app.deleteMovieImageHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/images/*key", app.serveImageHandler)
+	router.Handler(http.MethodGet, "/v1/movies/:id/reviews", app.authenticate(app.organization(app.listMovieReviewsHandler)))
+	router.Handler(http.MethodPost, "/v1/movies/:id/reviews", app.authenticate(app.organization(app.requireActivatedUser(app.createMovieReviewHandler))))
+	router.Handler(http.MethodGet, "/v1/movies/:id/reviews/:review_id", app.authenticate(app.organization(app.showMovieReviewHandler)))
+	router.Handler(http.MethodPatch, "/v1/movies/:id/reviews/:review_id", app.authenticate(app.organization(app.requireActivatedUser(app.updateMovieReviewHandler))))
+	router.Handler(http.MethodDelete, "/v1/movies/:id/reviews/:review_id", app.authenticate(app.organization(app.requireActivatedUser(app.deleteMovieReviewHandler))))
+	router.Handler(http.MethodPost, "/v1/movies/:id/reviews/:review_id/reports", app.authenticate(app.organization(app.requireActivatedUser(app.reportReviewHandler))))
+	router.Handler(http.MethodPut, "/v1/movies/:id/reviews/:review_id/hidden", app.authenticate(app.requirePermission("reviews:moderate", app.organization(app.updateReviewHiddenHandler))))
+	router.Handler(http.MethodGet, "/v1/reviews/reports", app.authenticate(app.requirePermission("reviews:moderate", app.organization(app.listReviewReportsHandler))))
+
+	router.Handler(http.MethodPost, "/v1/movies/:id/credits", app.authenticate(app.organization(app.createCreditHandler)))
+	router.Handler(http.MethodDelete, "/v1/movies/:id/credits/:credit_id", app.authenticate(app.organization(app.deleteCreditHandler)))
+	router.Handler(http.MethodGet, "/v1/people", app.authenticate(app.organization(app.listPeopleHandler)))
+	router.Handler(http.MethodPost, "/v1/people", app.authenticate(app.organization(app.createPersonHandler)))
+	router.Handler(http.MethodGet, "/v1/people/:id", app.authenticate(app.organization(app.showPersonHandler)))
+	router.Handler(http.MethodPatch, "/v1/people/:id", app.authenticate(app.organization(app.updatePersonHandler)))
+	router.Handler(http.MethodDelete, "/v1/people/:id", app.authenticate(app.organization(app.deletePersonHandler)))
+
+	router.Handler(http.MethodGet, "/v1/lists", app.authenticate(app.organization(app.requireActivatedUser(app.listListsHandler))))
+	router.Handler(http.MethodPost, "/v1/lists", app.authenticate(app.organization(app.requireActivatedUser(app.createListHandler))))
+	router.Handler(http.MethodGet, "/v1/lists/:id", app.authenticate(app.organization(app.requireActivatedUser(app.showListHandler))))
+	router.Handler(http.MethodPatch, "/v1/lists/:id", app.authenticate(app.organization(app.requireActivatedUser(app.updateListHandler))))
+	router.Handler(http.MethodDelete, "/v1/lists/:id", app.authenticate(app.organization(app.requireActivatedUser(app.deleteListHandler))))
+	router.Handler(http.MethodPut, "/v1/lists/:id/movies/:movie_id", app.authenticate(app.organization(app.requireActivatedUser(app.setListItemHandler))))
+	router.Handler(http.MethodDelete, "/v1/lists/:id/movies/:movie_id", app.authenticate(app.organization(app.requireActivatedUser(app.removeListItemHandler))))
+	router.HandlerFunc(http.MethodGet, "/v1/public-lists/:slug", app.showPublicListHandler)
+
+	router.Handler(http.MethodGet, "/v1/orgs", app.authenticate(app.requireActivatedUser(app.listOrganizationsHandler)))
+	router.Handler(http.MethodPost, "/v1/orgs", app.authenticate(app.requireActivatedUser(app.createOrganizationHandler)))
+	router.Handler(http.MethodGet, "/v1/orgs/:slug/members", app.authenticate(app.requireActivatedUser(app.requireOrganizationRole(data.OrgRoleViewer, app.listMembersHandler))))
+	router.Handler(http.MethodPut, "/v1/orgs/:slug/members/:id", app.authenticate(app.requireActivatedUser(app.requireOrganizationRole(data.OrgRoleAdmin, app.setMemberHandler))))
+	router.Handler(http.MethodDelete, "/v1/orgs/:slug/members/:id", app.authenticate(app.requireActivatedUser(app.requireOrganizationRole(data.OrgRoleAdmin, app.removeMemberHandler))))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+
+	router.Handler(http.MethodPatch, "/v1/users/me", app.authenticate(app.requireActivatedUser(app.requireSessionAuth(app.updateCurrentUserHandler))))
+	router.Handler(http.MethodDelete, "/v1/users/me", app.authenticate(app.requireAuthenticatedUser(app.requireSessionAuth(app.deleteCurrentUserHandler))))
+	router.Handler(http.MethodGet, "/v1/users/me/export", app.authenticate(app.requireAuthenticatedUser(app.requireSessionAuth(app.exportCurrentUserHandler))))
+	router.Handler(http.MethodPut, "/v1/users/me/password", app.authenticate(app.requireActivatedUser(app.requireSessionAuth(app.changeCurrentUserPasswordHandler))))
+
+	router.Handler(http.MethodGet, "/v1/users/me/sessions", app.authenticate(app.requireAuthenticatedUser(app.requireSessionAuth(app.listSessionsHandler))))
+	router.Handler(http.MethodDelete, "/v1/users/me/sessions/:id", app.authenticate(app.requireAuthenticatedUser(app.requireSessionAuth(app.deleteSessionHandler))))
+
+	router.Handler(http.MethodGet, "/v1/users/me/api-keys", app.authenticate(app.requireActivatedUser(app.requireSessionAuth(app.listAPIKeysHandler))))
+	router.Handler(http.MethodPost, "/v1/users/me/api-keys", app.authenticate(app.requireActivatedUser(app.requireSessionAuth(app.createAPIKeyHandler))))
+	router.Handler(http.MethodDelete, "/v1/users/me/api-keys/:id", app.authenticate(app.requireActivatedUser(app.requireSessionAuth(app.deleteAPIKeyHandler))))
+
+	router.Handler(http.MethodPost, "/v1/users/me/mfa/totp", app.authenticate(app.requireActivatedUser(app.requireSessionAuth(app.enrolTOTPHandler))))
+	router.Handler(http.MethodPut, "/v1/users/me/mfa/totp", app.authenticate(app.requireActivatedUser(app.requireSessionAuth(app.confirmTOTPHandler))))
+	router.Handler(http.MethodDelete, "/v1/users/me/mfa/totp", app.authenticate(app.requireActivatedUser(app.requireSessionAuth(app.disableTOTPHandler))))
+
+	router.Handler(http.MethodGet, "/v1/admin/users", app.authenticate(app.requirePermission("users:admin", app.listUsersHandler)))
+	router.Handler(http.MethodGet, "/v1/admin/users/:id", app.authenticate(app.requirePermission("users:admin", app.showUserHandler)))
+	router.Handler(http.MethodPost, "/v1/admin/users/:id/permissions", app.authenticate(app.requirePermission("users:admin", app.grantUserPermissionsHandler)))
+	router.Handler(http.MethodDelete, "/v1/admin/users/:id/permissions", app.authenticate(app.requirePermission("users:admin", app.revokeUserPermissionsHandler)))
+	router.Handler(http.MethodPut, "/v1/admin/users/:id/suspended", app.authenticate(app.requirePermission("users:admin", app.updateUserSuspendedHandler)))
+	router.Handler(http.MethodDelete, "/v1/admin/users/:id/sessions", app.authenticate(app.requirePermission("users:admin", app.deleteUserSessionsHandler)))
+	router.Handler(http.MethodDelete, "/v1/admin/users/:id/lockout", app.authenticate(app.requirePermission("users:admin", app.unlockUserHandler)))
+	router.Handler(http.MethodGet, "/v1/admin/invitations", app.authenticate(app.requirePermission("users:admin", app.listInvitationsHandler)))
+	router.Handler(http.MethodPost, "/v1/admin/invitations", app.authenticate(app.requirePermission("users:admin", app.createInvitationHandler)))
+	router.Handler(http.MethodDelete, "/v1/admin/invitations/:id", app.authenticate(app.requirePermission("users:admin", app.deleteInvitationHandler)))
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication/mfa", app.createMFAAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication/magic", app.createMagicLinkAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication/oidc", app.createOIDCAuthenticationTokenHandler)
+	router.Handler(http.MethodDelete, "/v1/tokens/authentication", app.authenticate(app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/magic-link", app.createMagicLinkTokenHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/oidc/:provider/authorize", app.createOIDCAuthorizationHandler)
 
 	return router
 }
@@ -60,9 +228,26 @@ func (app *application) routesMiddlewareTest() http.Handler {
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
-	router.Handler(http.MethodGet, "/v1/movies", app.rateLimit(http.HandlerFunc(app.listMoviesHandler)))
+	router.Handler(http.MethodGet, "/v1/movies", app.rateLimit(app.authenticate(app.organization(app.listMoviesHandler))))
 
-	router.Handler(http.MethodPatch, "/v1/movies/:id", app.authenticate(http.HandlerFunc(app.updateMovieHandler)))
+	router.Handler(http.MethodGet, "/v1/movies/:id", app.authenticate(app.requirePermission("movies:read", app.requireOrganizationRole(data.OrgRoleViewer, app.showMovieHandler))))
+	router.Handler(http.MethodPatch, "/v1/movies/:id", app.authenticate(app.organization(app.updateMovieHandler)))
+	router.Handler(http.MethodDelete, "/v1/movies/:id", app.authenticate(app.requirePermission("movies:write", app.requireOrganizationRole(data.OrgRoleEditor, app.deleteMovieHandler))))
 
 	return router
 }
+
+// staticOr sends requests whose param is value to static, and everything else to next.
+// httprouter won't register a static segment like /v1/movies/trash alongside a parameter
+// like /v1/movies/:id, so the static route has to be picked out by hand. Where a method has
+// only the static route, next is methodNotAllowedResponse, which is what httprouter would
+// have sent for the other values without the parameter route.
+func staticOr(param, value string, static, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if httprouter.ParamsFromContext(r.Context()).ByName(param) == value {
+			static(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -21,6 +21,7 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 	shutdownError := make(chan error)
+	done := make(chan struct{})
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -43,6 +44,7 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 
+		close(done)
 		app.wg.Wait()
 		shutdownError <- nil
 
@@ -52,6 +54,8 @@ func (app *application) serve() error {
 		"env":  app.config.env,
 	})
 
+	app.runJobs(done)
+
 	err := srv.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
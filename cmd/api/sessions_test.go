@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestListSessions(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid req",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusOK,
+			wantBody: `"current":true`,
+		},
+		{
+			name:     "Anonymous",
+			token:    "",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Database fall",
+			token:    "Bearer TokenPlainTextForTokenTes5",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				if tt.name == "Fake json.Write" {
+					storedMarshal := jsonMarshal
+					jsonMarshal = ts.fakeMarshal
+					defer ts.restoreMarshal(storedMarshal)
+				}
+
+				code, _, body := ts.getForAuth(t, "/v1/users/me/sessions", authHeader(t, app, tt.token))
+
+				assert.Equal(t, code, tt.wantCode)
+
+				if tt.wantBody != "" {
+					assert.StringContains(t, body, tt.wantBody)
+				}
+			})
+		}
+
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "Revoke session",
+			urlPath:  "/v1/users/me/sessions/1",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Anonymous",
+			urlPath:  "/v1/users/me/sessions/1",
+			token:    "",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/v1/users/me/sessions/3",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/v1/users/me/sessions/foo",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Database fall",
+			urlPath:  "/v1/users/me/sessions/1",
+			token:    "Bearer TokenPlainTextForTokenTes5",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			urlPath:  "/v1/users/me/sessions/1",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				if tt.name == "Fake json.Write" {
+					storedMarshal := jsonMarshal
+					jsonMarshal = ts.fakeMarshal
+					defer ts.restoreMarshal(storedMarshal)
+				}
+
+				code, _, _ := ts.deleteForAuth(t, tt.urlPath, authHeader(t, app, tt.token))
+
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+
+	}
+}
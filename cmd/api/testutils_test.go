@@ -6,10 +6,15 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"greenlight.bcc/internal/blob"
 	"greenlight.bcc/internal/data"
 	"greenlight.bcc/internal/jsonlog"
+	"greenlight.bcc/internal/jwt"
+	"greenlight.bcc/internal/validator"
 )
 
 func newTestApplication(t *testing.T) *application {
@@ -19,12 +24,77 @@ func newTestApplication(t *testing.T) *application {
 		burst   int
 		enabled bool
 	}{2, 4, true}}
+	cfg.auth.mode = authModeToken
+	cfg.auth.accessTokenTTL = 15 * time.Minute
+	cfg.auth.refreshTokenTTL = 30 * 24 * time.Hour
+	cfg.auth.magicLinkEnabled = true
+	cfg.registration.mode = registrationModeOpen
+	cfg.registration.defaultRole = "viewer"
+	cfg.registration.defaultOrganization = data.DefaultOrganizationSlug
+	cfg.users.deletionGracePeriod = 30 * 24 * time.Hour
+	cfg.movies.trashRetention = 30 * 24 * time.Hour
+	cfg.movies.importMaxBytes = 64 * 1024
+	cfg.reviews.editWindow = 24 * time.Hour
+	cfg.images.maxBytes = 64 * 1024
+	cfg.images.maxDimension = 1000
+	cfg.lockout = data.LockoutPolicy{MaxAttempts: 5, Window: 15 * time.Minute, Duration: time.Minute, MaxDuration: 24 * time.Hour}
+
+	blobs, err := blob.NewFileStore(t.TempDir(), "/v1/images")
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	return &application{
 		config: cfg,
 		logger: jsonlog.New(io.Discard, jsonlog.LevelFatal),
 		models: data.NewMockModels(),
+		blobs:  blobs,
+	}
+}
+
+var authModes = []string{authModeToken, authModeJWT}
+
+func newTestApplicationForAuthMode(t *testing.T, mode string) *application {
+	app := newTestApplication(t)
+
+	app.config.auth.mode = mode
+	if mode == authModeJWT {
+		app.jwtSigner = jwt.NewHS256([]byte("a-test-secret-which-is-32-bytes!"))
+	}
+
+	return app
+}
+
+// authHeader translates an Authorization header carrying one of the mock opaque tokens
+// into the equivalent header for the application's auth mode, so that the same test
+// tables can be run against both modes.
+func authHeader(t *testing.T, app *application, header string) string {
+	t.Helper()
+
+	if app.config.auth.mode != authModeJWT || !strings.HasPrefix(header, "Bearer ") {
+		return header
+	}
+
+	plaintext := strings.TrimPrefix(header, "Bearer ")
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, plaintext); !v.Valid() {
+		return header
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeAuthentication, plaintext)
+	if err != nil {
+		return header
 	}
+
+	permissions, _ := app.models.Permissions.GetAllForUser(user.ID)
+
+	token, err := app.signAccessToken(user, permissions, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "Bearer " + token.Plaintext
 }
 
 type testServer struct {
@@ -176,3 +246,137 @@ func (ts *testServer) patchForAuth(t *testing.T, urlPath string, data []byte, to
 
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+func (ts *testServer) getForAuth(t *testing.T, urlPath string, token string) (int, http.Header, string) {
+	req, err := http.NewRequest(http.MethodGet, ts.URL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", token)
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
+
+func (ts *testServer) deleteForAuth(t *testing.T, urlPath string, token string) (int, http.Header, string) {
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", token)
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
+
+func (ts *testServer) postForAuth(t *testing.T, urlPath string, data []byte, token string) (int, http.Header, string) {
+	reader := bytes.NewReader(data)
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", token)
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
+
+func (ts *testServer) updateForAuth(t *testing.T, urlPath string, data []byte, token string) (int, http.Header, string) {
+	return ts.doForAuth(t, http.MethodPut, urlPath, data, token)
+}
+
+func (ts *testServer) deleteWithBodyForAuth(t *testing.T, urlPath string, data []byte, token string) (int, http.Header, string) {
+	return ts.doForAuth(t, http.MethodDelete, urlPath, data, token)
+}
+
+func (ts *testServer) doForAuth(t *testing.T, method, urlPath string, data []byte, token string) (int, http.Header, string) {
+	reader := bytes.NewReader(data)
+
+	req, err := http.NewRequest(method, ts.URL+urlPath, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", token)
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
+
+func (ts *testServer) doWithHeaders(t *testing.T, method, urlPath string, data []byte, headers map[string]string) (int, http.Header, string) {
+	reader := bytes.NewReader(data)
+
+	req, err := http.NewRequest(method, ts.URL+urlPath, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"greenlight.bcc/internal/data"
@@ -29,11 +30,24 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	// Check the lockout before anything else, so that a locked address costs no bcrypt
+	// comparison and gets the same response whether or not it has an account.
+	throttle, err := app.models.LoginThrottles.Get(input.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if throttle.Locked(time.Now()) {
+		app.accountLockedResponse(w, r, throttle.RetryAfter(time.Now()))
+		return
+	}
+
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.invalidCredentialsResponse(w, r)
+			app.failedLoginResponse(w, r, input.Email, nil, app.invalidCredentialsResponse)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -47,17 +61,484 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	}
 
 	if !match {
-		app.invalidCredentialsResponse(w, r)
+		app.failedLoginResponse(w, r, input.Email, user, app.invalidCredentialsResponse)
+		return
+	}
+
+	app.beginSession(w, r, user)
+}
+
+// failedLoginResponse records a failed login for email and sends the response for it, which
+// is invalid unless the failure locks the address. The user is nil when the address has no
+// account; otherwise they are told by email when the failure locks their account.
+func (app *application) failedLoginResponse(w http.ResponseWriter, r *http.Request, email string, user *data.User, invalid func(http.ResponseWriter, *http.Request)) {
+	throttle, locked, err := app.models.LoginThrottles.RecordFailure(email, app.config.lockout)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !locked {
+		invalid(w, r)
+		return
+	}
+
+	if user != nil {
+		ip := app.clientIP(r)
+
+		app.logger.PrintInfo("account locked after failed logins", map[string]string{
+			"user_id": strconv.FormatInt(user.ID, 10),
+			"ip":      ip,
+		})
+
+		app.background(func() {
+			data := map[string]any{
+				"lockedUntil": throttle.LockedUntil.Format(time.RFC1123),
+				"ip":          ip,
+			}
+
+			err := app.mailer.Send(user.Email, "account_locked.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	app.accountLockedResponse(w, r, throttle.RetryAfter(time.Now()))
+}
+
+// beginSession is called once a user has proved their identity with a first factor. Users
+// who have enrolled in two-factor authentication are given a short-lived mfa token to
+// exchange, along with a code, at POST /v1/tokens/authentication/mfa; everyone else gets
+// their session tokens straight away. The login throttle is only cleared once the session
+// tokens are issued, so that a correct password doesn't let the second factor be guessed.
+func (app *application) beginSession(w http.ResponseWriter, r *http.Request, user *data.User) {
+	if user.IsSuspended() {
+		app.accountSuspendedResponse(w, r)
+		return
+	}
+
+	totp, err := app.models.MFA.GetTOTP(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if totp != nil && totp.Confirmed() {
+		token, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeMFA)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		env := envelope{"mfa_token": token, "mfa_methods": []string{"totp", "recovery_code"}}
+
+		err = app.writeJSON(w, http.StatusAccepted, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.LoginThrottles.Reset(user.Email, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env, err := app.newSessionTokens(r, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// newSessionTokens issues a short-lived authentication token together with the long-lived
+// refresh token that can be exchanged for the next pair. Depending on the auth mode the
+// authentication token is either stored in the tokens table or is a signed JWT. Either
+// way it carries the refresh token's ID, so that the whole session can be ended at once.
+func (app *application) newSessionTokens(r *http.Request, user *data.User) (envelope, error) {
+	refreshToken, err := app.models.Tokens.NewSession(user.ID, app.config.auth.refreshTokenTTL, data.ScopeRefresh, r.UserAgent(), app.clientIP(r), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var accessToken *data.Token
+	switch app.config.auth.mode {
+	case authModeJWT:
+		accessToken, err = app.newJWTAccessToken(user, refreshToken.ID)
+	default:
+		accessToken, err = app.models.Tokens.NewSession(user.ID, app.config.auth.accessTokenTTL, data.ScopeAuthentication, r.UserAgent(), app.clientIP(r), refreshToken.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope{"authentication_token": accessToken, "refresh_token": refreshToken}, nil
+}
+
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := app.models.Tokens.GetByPlaintext(data.ScopeRefresh, input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if token.RotatedAt == nil {
+		err = app.models.Tokens.Rotate(token)
+	} else {
+		err = data.ErrEditConflict
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.revokeReusedRefreshToken(w, r, token)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.Get(token.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.IsSuspended() {
+		app.accountSuspendedResponse(w, r)
+		return
+	}
+
+	env, err := app.newSessionTokens(r, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeReusedRefreshToken handles a refresh token being presented after it was already
+// rotated. That means it has leaked, so every session belonging to the user is revoked.
+func (app *application) revokeReusedRefreshToken(w http.ResponseWriter, r *http.Request, token *data.Token) {
+	app.logger.PrintInfo("refresh token reuse detected, revoking all sessions", map[string]string{
+		"user_id": strconv.FormatInt(token.UserID, 10),
+		"ip":      app.clientIP(r),
+	})
+
+	for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+		err := app.models.Tokens.DeleteAllForUser(scope, token.UserID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.invalidRefreshTokenResponse(w, r)
+}
+
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{"message": "an email will be sent to you containing password reset instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.writeJSON(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.Activated {
+		token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background(func() {
+			data := map[string]any{
+				"passwordResetToken": token.Plaintext,
+			}
+
+			err = app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{"message": "an email will be sent to you containing activation instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.writeJSON(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	// A suspended user is told the same as anyone else, but isn't sent a token.
+	if !user.Activated && !user.IsSuspended() {
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background(func() {
+			data := map[string]any{
+				"activationToken": token.Plaintext,
+			}
+
+			err = app.mailer.Send(user.Email, "token_activation.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createMagicLinkTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.config.auth.magicLinkEnabled {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{"message": "an email will be sent to you containing a login link"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.writeJSON(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.Activated && !user.IsSuspended() {
+		// Only the most recent link works.
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeMagicLink, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		token, err := app.models.Tokens.New(user.ID, 15*time.Minute, data.ScopeMagicLink)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background(func() {
+			data := map[string]any{
+				"magicLinkToken": token.Plaintext,
+			}
+
+			err = app.mailer.Send(user.Email, "token_magic_link.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createMagicLinkAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.config.auth.magicLinkEnabled {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeMagicLink, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired magic link token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeMagicLink, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.beginSession(w, r, user)
+}
+
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if app.contextGetToken(r) == "" {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	var err error
+
+	switch app.config.auth.mode {
+	case authModeJWT:
+		// A JWT can't be revoked before it expires, so end the session by revoking the
+		// refresh token that it was issued alongside.
+		var claims *accessClaims
+		claims, err = app.parseJWTAccessToken(app.contextGetToken(r))
+		if err == nil {
+			err = app.models.Tokens.DeleteForUser(claims.SessionID, app.contextGetUser(r).ID)
+		}
+	default:
+		err = app.models.Tokens.DeleteSessionByPlaintext(app.contextGetToken(r))
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been successfully logged out"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -6,12 +6,10 @@ import (
 	"testing"
 
 	"greenlight.bcc/internal/assert"
+	"greenlight.bcc/internal/data"
 )
 
 func TestCreateToken(t *testing.T) {
-	app := newTestApplication(t)
-	ts := newTestServer(t, app.routesTest())
-	defer ts.Close()
 
 	const (
 		validEmail                      = "test0@test.com"
@@ -21,6 +19,7 @@ func TestCreateToken(t *testing.T) {
 		invalidPasswordEmail            = "test3@test.com"
 		invalidCredentialsPasswordEmail = "test4@test.com"
 		tokenErrorEmail                 = "test5@test.com"
+		mfaEmail                        = "test8@test.com"
 	)
 
 	tests := []struct {
@@ -71,6 +70,30 @@ func TestCreateToken(t *testing.T) {
 			Password: validPassword,
 			wantCode: http.StatusInternalServerError,
 		},
+		{
+			name:     "MFA required",
+			Email:    mfaEmail,
+			Password: validPassword,
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Locked out",
+			Email:    "locked@test.com",
+			Password: validPassword,
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name:     "Failure locks account",
+			Email:    "locking@test.com",
+			Password: "aaaaaaaa",
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name:     "Throttle error",
+			Email:    "throttlefall@test.com",
+			Password: validPassword,
+			wantCode: http.StatusInternalServerError,
+		},
 		{
 			name:     "Fake json.Write",
 			Email:    validEmail,
@@ -79,6 +102,95 @@ func TestCreateToken(t *testing.T) {
 		},
 	}
 
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+
+				if tt.name == "Fake json.Write" {
+					storedMarshal := jsonMarshal
+					jsonMarshal = ts.fakeMarshal
+					defer ts.restoreMarshal(storedMarshal)
+				}
+
+				inputData := struct {
+					Email    string `json:"email"`
+					Password string `json:"password"`
+				}{
+					Email:    tt.Email,
+					Password: tt.Password,
+				}
+
+				b, err := json.Marshal(&inputData)
+				if err != nil {
+					t.Fatal("wrong input data")
+				}
+				if tt.name == "test for wrong input" {
+					b = append(b, 'a')
+				}
+
+				code, _, _ := ts.postForm(t, "/v1/tokens/authentication", b)
+
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+
+		code, _, _ := ts.postForm(t, "/v1/tokens/authentication", []byte{})
+
+		assert.Equal(t, code, http.StatusBadRequest)
+
+		code, header, _ := ts.postForm(t, "/v1/tokens/authentication", []byte(`{"email": "locked@test.com", "password": "TestPassword"}`))
+
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.Equal(t, header.Get("Retry-After"), "300")
+	}
+}
+
+func TestCreatePasswordResetToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		Email    string
+		wantCode int
+	}{
+		{
+			name:     "Valid email",
+			Email:    "test0@test.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Unknown email",
+			Email:    "test1@test.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "InternalServerError after GetByEmail",
+			Email:    "test2@test.com",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Email validation fail",
+			Email:    "invalid",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "token error",
+			Email:    "test5@test.com",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			Email:    "test0@test.com",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
@@ -89,28 +201,485 @@ func TestCreateToken(t *testing.T) {
 			}
 
 			inputData := struct {
-				Email    string `json:"email"`
-				Password string `json:"password"`
+				Email string `json:"email"`
 			}{
-				Email:    tt.Email,
-				Password: tt.Password,
+				Email: tt.Email,
 			}
 
 			b, err := json.Marshal(&inputData)
 			if err != nil {
 				t.Fatal("wrong input data")
 			}
-			if tt.name == "test for wrong input" {
-				b = append(b, 'a')
+
+			code, _, _ := ts.postForm(t, "/v1/tokens/password-reset", b)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	code, _, _ := ts.postForm(t, "/v1/tokens/password-reset", []byte{})
+
+	assert.Equal(t, code, http.StatusBadRequest)
+}
+
+func TestCreateActivationToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		Email    string
+		wantCode int
+	}{
+		{
+			name:     "Not activated user",
+			Email:    "test6@test.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Already activated user",
+			Email:    "test0@test.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Unknown email",
+			Email:    "test1@test.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "InternalServerError after GetByEmail",
+			Email:    "test2@test.com",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Email validation fail",
+			Email:    "invalid",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Delete all for user error",
+			Email:    "test7@test.com",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			Email:    "test6@test.com",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
 			}
 
-			code, _, _ := ts.postForm(t, "/v1/tokens/authentication", b)
+			inputData := struct {
+				Email string `json:"email"`
+			}{
+				Email: tt.Email,
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, _, _ := ts.postForm(t, "/v1/tokens/activation", b)
 
 			assert.Equal(t, code, tt.wantCode)
 		})
 	}
 
-	code, _, _ := ts.postForm(t, "/v1/tokens/authentication", []byte{})
+	code, _, _ := ts.postForm(t, "/v1/tokens/activation", []byte{})
 
 	assert.Equal(t, code, http.StatusBadRequest)
 }
+
+func TestDeleteAuthenticationToken(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "Logout",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Anonymous",
+			token:    "",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Delete error",
+			token:    "Bearer TokenPlainTextForTokenTes5",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				if tt.name == "Fake json.Write" {
+					storedMarshal := jsonMarshal
+					jsonMarshal = ts.fakeMarshal
+					defer ts.restoreMarshal(storedMarshal)
+				}
+
+				code, _, _ := ts.deleteForAuth(t, "/v1/tokens/authentication", authHeader(t, app, tt.token))
+
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+
+	}
+}
+
+func TestRefreshAuthenticationToken(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		RefreshToken string
+		Mock         string
+		wantCode     int
+		wantBody     string
+	}{
+		{
+			name:         "Rotate tokens",
+			RefreshToken: "TokenPlainTextForTokenTest",
+			wantCode:     http.StatusCreated,
+			wantBody:     "refresh_token",
+		},
+		{
+			name:         "Wrong input",
+			RefreshToken: "TokenPlainTextForTokenTest",
+			Mock:         "mock",
+			wantCode:     http.StatusBadRequest,
+		},
+		{
+			name:         "Invalid token",
+			RefreshToken: "invalid_token",
+			wantCode:     http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Token not found",
+			RefreshToken: "TokenPlainTextForTokenTes1",
+			wantCode:     http.StatusUnauthorized,
+		},
+		{
+			name:         "Token, database fall",
+			RefreshToken: "TokenPlainTextForTokenTes2",
+			wantCode:     http.StatusInternalServerError,
+		},
+		{
+			name:         "Reused token",
+			RefreshToken: "TokenPlainTextForTokenTes3",
+			wantCode:     http.StatusUnauthorized,
+		},
+		{
+			name:         "Concurrent rotation",
+			RefreshToken: "TokenPlainTextForTokenTes4",
+			wantCode:     http.StatusUnauthorized,
+		},
+		{
+			name:         "New session error",
+			RefreshToken: "TokenPlainTextForTokenTes5",
+			wantCode:     http.StatusInternalServerError,
+		},
+		{
+			name:         "Fake json.Write",
+			RefreshToken: "TokenPlainTextForTokenTest",
+			wantCode:     http.StatusInternalServerError,
+		},
+	}
+
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				if tt.name == "Fake json.Write" {
+					storedMarshal := jsonMarshal
+					jsonMarshal = ts.fakeMarshal
+					defer ts.restoreMarshal(storedMarshal)
+				}
+
+				inputData := struct {
+					RefreshToken string `json:"refresh_token"`
+					Mock         string `json:"mock,omitempty"`
+				}{
+					RefreshToken: tt.RefreshToken,
+					Mock:         tt.Mock,
+				}
+
+				b, err := json.Marshal(&inputData)
+				if err != nil {
+					t.Fatal("wrong input data")
+				}
+
+				code, _, body := ts.postForm(t, "/v1/tokens/refresh", b)
+
+				assert.Equal(t, code, tt.wantCode)
+
+				if tt.wantBody != "" {
+					assert.StringContains(t, body, tt.wantBody)
+				}
+			})
+		}
+
+	}
+}
+
+func TestCreateMagicLinkToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		Email    string
+		wantCode int
+	}{
+		{
+			name:     "Valid email",
+			Email:    "test0@test.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Unknown email",
+			Email:    "test1@test.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Not activated",
+			Email:    "test6@test.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "InternalServerError after GetByEmail",
+			Email:    "test2@test.com",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Email validation fail",
+			Email:    "invalid",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "token error",
+			Email:    "test5@test.com",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			Email:    "test0@test.com",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			b, err := json.Marshal(map[string]string{"email": tt.Email})
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, _, _ := ts.postForm(t, "/v1/tokens/magic-link", b)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	code, _, _ := ts.postForm(t, "/v1/tokens/magic-link", []byte{})
+
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	app.config.auth.magicLinkEnabled = false
+
+	code, _, _ = ts.postForm(t, "/v1/tokens/magic-link", []byte(`{"email": "test0@test.com"}`))
+
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestCreateMagicLinkAuthenticationToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		Token    string
+		wantCode int
+	}{
+		{
+			name:     "Valid token",
+			Token:    "TokenPlainTextForTokenTest",
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "MFA required",
+			Token:    "TokenPlainTextForTokenTes7",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Token not found",
+			Token:    "TokenPlainTextForTokenTes1",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Token, database fall",
+			Token:    "TokenPlainTextForTokenTes2",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Delete tokens error",
+			Token:    "TokenPlainTextForTokenTes5",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Invalid token",
+			Token:    "invalid_token",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Fake json.Write",
+			Token:    "TokenPlainTextForTokenTest",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, mode := range authModes {
+		app := newTestApplicationForAuthMode(t, mode)
+		ts := newTestServer(t, app.routesTest())
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+
+				if tt.name == "Fake json.Write" {
+					storedMarshal := jsonMarshal
+					jsonMarshal = ts.fakeMarshal
+					defer ts.restoreMarshal(storedMarshal)
+				}
+
+				b, err := json.Marshal(map[string]string{"token": tt.Token})
+				if err != nil {
+					t.Fatal("wrong input data")
+				}
+
+				code, _, _ := ts.postForm(t, "/v1/tokens/authentication/magic", b)
+
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+
+		code, _, _ := ts.postForm(t, "/v1/tokens/authentication/magic", []byte{})
+
+		assert.Equal(t, code, http.StatusBadRequest)
+
+		app.config.auth.magicLinkEnabled = false
+
+		code, _, _ = ts.postForm(t, "/v1/tokens/authentication/magic", []byte(`{"token": "TokenPlainTextForTokenTest"}`))
+
+		assert.Equal(t, code, http.StatusNotFound)
+	}
+}
+
+// sessionTokenModel remembers the tokens of one session, so that tests can see which of
+// them survive a logout.
+type sessionTokenModel struct {
+	data.MockTokenModel
+	tokens map[string]*data.Token
+}
+
+func (m *sessionTokenModel) GetByPlaintext(scope, tokenPlaintext string) (*data.Token, error) {
+	token, ok := m.tokens[tokenPlaintext]
+	if !ok || token.Scope != scope {
+		return nil, data.ErrRecordNotFound
+	}
+	return token, nil
+}
+
+func (m *sessionTokenModel) DeleteSessionByPlaintext(tokenPlaintext string) error {
+	token, ok := m.tokens[tokenPlaintext]
+	if !ok || token.Scope != data.ScopeAuthentication {
+		return data.ErrRecordNotFound
+	}
+
+	for plaintext, other := range m.tokens {
+		if other.ID == token.ID || other.ID == token.SessionID {
+			delete(m.tokens, plaintext)
+		}
+	}
+	return nil
+}
+
+func (m *sessionTokenModel) RevokeAllForUser(userID int64, audit *data.AuditEntry) error {
+	for plaintext, token := range m.tokens {
+		if token.UserID == userID {
+			delete(m.tokens, plaintext)
+		}
+	}
+	return nil
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	app := newTestApplication(t)
+
+	tokens := &sessionTokenModel{tokens: map[string]*data.Token{
+		"TokenPlainTextForTokenTest": {ID: 1, UserID: 1, Scope: data.ScopeAuthentication, SessionID: 2},
+		"RefreshTokenForLogoutTestX": {ID: 2, UserID: 1, Scope: data.ScopeRefresh},
+	}}
+	app.models.Tokens = tokens
+
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	code, _, _ := ts.deleteForAuth(t, "/v1/tokens/authentication", "Bearer TokenPlainTextForTokenTest")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(tokens.tokens), 0)
+
+	code, _, body := ts.postForm(t, "/v1/tokens/refresh", []byte(`{"refresh_token": "RefreshTokenForLogoutTestX"}`))
+	assert.Equal(t, code, http.StatusUnauthorized)
+	assert.StringContains(t, body, "invalid or expired refresh token")
+}
+
+func TestPasswordResetRevokesRefreshToken(t *testing.T) {
+	app := newTestApplication(t)
+
+	tokens := &sessionTokenModel{tokens: map[string]*data.Token{
+		"RefreshTokenForLogoutTestX": {ID: 2, UserID: 1, Scope: data.ScopeRefresh},
+	}}
+	app.models.Tokens = tokens
+
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	code, _, _ := ts.updateReq(t, "/v1/users/password", []byte(`{"password": "NewPassword", "token": "TokenPlainTextForTokenTest"}`))
+	assert.Equal(t, code, http.StatusOK)
+
+	code, _, body := ts.postForm(t, "/v1/tokens/refresh", []byte(`{"refresh_token": "RefreshTokenForLogoutTestX"}`))
+	assert.Equal(t, code, http.StatusUnauthorized)
+	assert.StringContains(t, body, "invalid or expired refresh token")
+}
@@ -231,3 +231,532 @@ func TestActivateUser(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateUserPassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	const (
+		validToken             = "TokenPlainTextForTokenTest"
+		validPassword          = "NewPassword"
+		notFoundToken          = "TokenPlainTextForTokenTes1"
+		internalServerErrToken = "TokenPlainTextForTokenTes2"
+		editConflictToken      = "TokenPlainTextForTokenTes3"
+		updateErrToken         = "TokenPlainTextForTokenTes4"
+		deleteAllForTokenError = "TokenPlainTextForTokenTes5"
+	)
+
+	tests := []struct {
+		name     string
+		Password string
+		Token    string
+		Mock     string
+		wantCode int
+	}{
+		{
+			name:     "Valid input",
+			Password: validPassword,
+			Token:    validToken,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Wrong input",
+			Password: validPassword,
+			Token:    validToken,
+			Mock:     "mock",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Short password",
+			Password: "short",
+			Token:    validToken,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Invalid token",
+			Password: validPassword,
+			Token:    "invalid_token",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Token not found",
+			Password: validPassword,
+			Token:    notFoundToken,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Token, database fall",
+			Password: validPassword,
+			Token:    internalServerErrToken,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Edit conflict",
+			Password: validPassword,
+			Token:    editConflictToken,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Update error",
+			Password: validPassword,
+			Token:    updateErrToken,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Delete all for Token error",
+			Password: validPassword,
+			Token:    deleteAllForTokenError,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Fake json.Write",
+			Password: validPassword,
+			Token:    validToken,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputData := struct {
+				Password string `json:"password"`
+				Token    string `json:"token"`
+				Mock     string `json:"mock,omitempty"`
+			}{
+				Password: tt.Password,
+				Token:    tt.Token,
+				Mock:     tt.Mock,
+			}
+
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, _, _ := ts.updateReq(t, "/v1/users/password", b)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestUpdateCurrentUser(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	const validToken = "Bearer TokenPlainTextForTokenTest"
+
+	tests := []struct {
+		name     string
+		token    string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Change name",
+			token:    validToken,
+			body:     `{"name": "New Name"}`,
+			wantCode: http.StatusOK,
+			wantBody: `"name":"New Name"`,
+		},
+		{
+			name:     "Change email",
+			token:    validToken,
+			body:     `{"email": "test1@new.com"}`,
+			wantCode: http.StatusOK,
+			wantBody: `"pending_email":"test1@new.com"`,
+		},
+		{
+			name:     "Cancel email change",
+			token:    validToken,
+			body:     `{"email": "test@test.com"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Email taken",
+			token:    validToken,
+			body:     `{"email": "test0@new.com"}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Email lookup error",
+			token:    validToken,
+			body:     `{"email": "test2@new.com"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Invalid email",
+			token:    validToken,
+			body:     `{"email": "invalid"}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Empty name",
+			token:    validToken,
+			body:     `{"name": ""}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Edit conflict",
+			token:    validToken,
+			body:     `{"name": "Conflict"}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Token error",
+			token:    "Bearer TokenPlainTextForTokenTes5",
+			body:     `{"email": "test1@new.com"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Anonymous",
+			token:    "",
+			body:     `{"name": "New Name"}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Wrong input",
+			token:    validToken,
+			body:     `{"name": "New Name"`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    validToken,
+			body:     `{"name": "New Name"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, body := ts.patchForAuth(t, "/v1/users/me", []byte(tt.body), tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		Token    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid token",
+			Token:    "TokenPlainTextForTokenTes9",
+			wantCode: http.StatusOK,
+			wantBody: `"email":"new@test.com"`,
+		},
+		{
+			name:     "No pending email",
+			Token:    "TokenPlainTextForTokenTest",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Email taken since",
+			Token:    "TokenPlainTextForTokenTesD",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Edit conflict",
+			Token:    "TokenPlainTextForTokenTesC",
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Token not found",
+			Token:    "TokenPlainTextForTokenTes1",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Token, database fall",
+			Token:    "TokenPlainTextForTokenTes2",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Invalid token",
+			Token:    "invalid_token",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Fake json.Write",
+			Token:    "TokenPlainTextForTokenTes9",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			b, err := json.Marshal(map[string]string{"token": tt.Token})
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, _, body := ts.updateReq(t, "/v1/users/email", b)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	code, _, _ := ts.updateReq(t, "/v1/users/email", []byte{})
+
+	assert.Equal(t, code, http.StatusBadRequest)
+}
+
+func TestChangeCurrentUserPassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	const validToken = "Bearer TokenPlainTextForTokenTest"
+
+	tests := []struct {
+		name            string
+		token           string
+		CurrentPassword string
+		Password        string
+		wantCode        int
+	}{
+		{
+			name:            "Valid input",
+			token:           validToken,
+			CurrentPassword: "TestPassword",
+			Password:        "NewPassword",
+			wantCode:        http.StatusOK,
+		},
+		{
+			name:            "Wrong current password",
+			token:           validToken,
+			CurrentPassword: "WrongPassword",
+			Password:        "NewPassword",
+			wantCode:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Missing current password",
+			token:    validToken,
+			Password: "NewPassword",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "Short password",
+			token:           validToken,
+			CurrentPassword: "TestPassword",
+			Password:        "short",
+			wantCode:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "Delete tokens error",
+			token:           "Bearer TokenPlainTextForTokenTes5",
+			CurrentPassword: "TestPassword",
+			Password:        "NewPassword",
+			wantCode:        http.StatusInternalServerError,
+		},
+		{
+			name:            "Anonymous",
+			token:           "",
+			CurrentPassword: "TestPassword",
+			Password:        "NewPassword",
+			wantCode:        http.StatusUnauthorized,
+		},
+		{
+			name:            "Fake json.Write",
+			token:           validToken,
+			CurrentPassword: "TestPassword",
+			Password:        "NewPassword",
+			wantCode:        http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			b, err := json.Marshal(map[string]string{"current_password": tt.CurrentPassword, "password": tt.Password})
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, _, _ := ts.updateForAuth(t, "/v1/users/me/password", b, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	code, _, _ := ts.updateForAuth(t, "/v1/users/me/password", []byte{}, validToken)
+
+	assert.Equal(t, code, http.StatusBadRequest)
+}
+
+func TestExportCurrentUser(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid request",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusOK,
+			wantBody: `"permissions":["movies:read"]`,
+		},
+		{
+			name:     "MFA enrolled",
+			token:    "Bearer TokenPlainTextForTokenTes7",
+			wantCode: http.StatusOK,
+			wantBody: `"totp_enabled":true`,
+		},
+		{
+			name:     "Database error",
+			token:    "Bearer TokenPlainTextForTokenTes5",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Anonymous",
+			token:    "",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    "Bearer TokenPlainTextForTokenTest",
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, header, body := ts.getForAuth(t, "/v1/users/me/export", tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+				assert.StringContains(t, header.Get("Content-Disposition"), "attachment")
+			}
+		})
+	}
+}
+
+func TestDeleteCurrentUser(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	const validToken = "Bearer TokenPlainTextForTokenTest"
+
+	tests := []struct {
+		name     string
+		token    string
+		body     string
+		wantCode int
+	}{
+		{
+			name:     "Valid password",
+			token:    validToken,
+			body:     `{"password": "TestPassword"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Wrong password",
+			token:    validToken,
+			body:     `{"password": "WrongPassword"}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Missing password",
+			token:    validToken,
+			body:     `{}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Soft delete error",
+			token:    "Bearer TokenPlainTextForTokenTes8",
+			body:     `{"password": "TestPassword"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Revoke sessions error",
+			token:    "Bearer TokenPlainTextForTokenTes5",
+			body:     `{"password": "TestPassword"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Anonymous",
+			token:    "",
+			body:     `{"password": "TestPassword"}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Wrong input",
+			token:    validToken,
+			body:     `{"password": 1}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Fake json.Write",
+			token:    validToken,
+			body:     `{"password": "TestPassword"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Fake json.Write" {
+				storedMarshal := jsonMarshal
+				jsonMarshal = ts.fakeMarshal
+				defer ts.restoreMarshal(storedMarshal)
+			}
+
+			code, _, _ := ts.deleteWithBodyForAuth(t, "/v1/users/me", []byte(tt.body), tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// AuditEntry records a change made by one user, usually an admin, to another user's
+// account.
+type AuditEntry struct {
+	ID        int64          `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	ActorID   int64          `json:"actor_id"`
+	UserID    int64          `json:"user_id"`
+	Action    string         `json:"action"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// withAudit runs fn in a transaction which also records entry, so that a change is never
+// committed without its audit entry or the other way round. The methods an admin can
+// call take an entry for this, which is nil when the change isn't an admin's.
+func withAudit(ctx context.Context, db *sql.DB, entry *AuditEntry, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	if entry != nil {
+		details, err := json.Marshal(entry.Details)
+		if err != nil {
+			return err
+		}
+		if entry.Details == nil {
+			details = []byte("{}")
+		}
+
+		query := `
+		INSERT INTO audit_log (actor_id, user_id, action, details)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+		args := []any{entry.ActorID, entry.UserID, entry.Action, details}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// mockAudit stands in for withAudit in the mocks. Recording an entry for user 6 fails.
+func mockAudit(entry *AuditEntry) error {
+	if entry == nil {
+		return nil
+	}
+	if entry.UserID == 6 {
+		return errors.New("error occurred")
+	}
+	entry.ID = 1
+	entry.CreatedAt = time.Now()
+	return nil
+}
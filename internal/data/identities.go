@@ -0,0 +1,305 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.bcc/internal/validator"
+)
+
+var (
+	ErrDuplicateIdentity = errors.New("duplicate identity")
+)
+
+// Identity links an account at an external OpenID Connect provider, identified by the
+// provider's subject, to a user.
+type Identity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginState is what needs remembering between sending a user to a provider and them
+// coming back with an authorization code. Only the hash of the state is stored.
+type LoginState struct {
+	Plaintext    string
+	Hash         []byte
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	Expiry       time.Time
+}
+
+func ValidateLoginState(v *validator.Validator, statePlaintext string) {
+	v.Check(statePlaintext != "", "state", "must be provided")
+	v.Check(len(statePlaintext) == 26, "state", "must be 26 bytes long")
+}
+
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+func (m IdentityModel) NewLoginState(provider, nonce, codeVerifier string, ttl time.Duration) (*LoginState, error) {
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &LoginState{
+		Plaintext:    base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes),
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		Expiry:       time.Now().Add(ttl),
+	}
+	hash := sha256.Sum256([]byte(state.Plaintext))
+	state.Hash = hash[:]
+
+	query := `
+	INSERT INTO oidc_login_states (hash, provider, nonce, code_verifier, expiry)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	args := []any{state.Hash, state.Provider, state.Nonce, state.CodeVerifier, state.Expiry}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// ConsumeLoginState() deletes and returns the unexpired login state, so that each one can
+// only be used once.
+func (m IdentityModel) ConsumeLoginState(statePlaintext string) (*LoginState, error) {
+	hash := sha256.Sum256([]byte(statePlaintext))
+
+	query := `
+	DELETE FROM oidc_login_states
+	WHERE hash = $1 AND expiry > NOW()
+	RETURNING provider, nonce, code_verifier, expiry`
+
+	state := LoginState{Plaintext: statePlaintext, Hash: hash[:]}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, state.Hash).Scan(&state.Provider, &state.Nonce, &state.CodeVerifier, &state.Expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &state, nil
+}
+
+// DeleteExpiredLoginStates() removes the states of logins which were never completed.
+func (m IdentityModel) DeleteExpiredLoginStates() (int64, error) {
+	query := `
+	DELETE FROM oidc_login_states
+	WHERE expiry <= NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetUser() returns the user linked to the provider's subject.
+func (m IdentityModel) GetUser(provider, subject string) (*User, error) {
+	query := `
+	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version, users.pending_email, users.suspended_at
+	FROM users
+	INNER JOIN user_identities
+	ON users.id = user_identities.user_id
+	WHERE user_identities.provider = $1
+	AND user_identities.subject = $2
+	AND users.deleted_at IS NULL`
+
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.PendingEmail,
+		&user.SuspendedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m IdentityModel) GetAllForUser(userID int64) ([]*Identity, error) {
+	query := `
+	SELECT id, user_id, provider, subject, email, created_at
+	FROM user_identities
+	WHERE user_id = $1
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+
+	for rows.Next() {
+		var identity Identity
+
+		err := rows.Scan(
+			&identity.ID,
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.Email,
+			&identity.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, &identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+func (m IdentityModel) Insert(identity *Identity) error {
+	query := `
+	INSERT INTO user_identities (user_id, provider, subject, email)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at`
+
+	args := []any{identity.UserID, identity.Provider, identity.Subject, identity.Email}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23505":
+			return ErrDuplicateIdentity
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MockOIDCNonce is the nonce of every login state returned by MockIdentityModel.
+const MockOIDCNonce = "mock-nonce"
+
+type MockIdentityModel struct{}
+
+func (m MockIdentityModel) NewLoginState(provider, nonce, codeVerifier string, ttl time.Duration) (*LoginState, error) {
+	if provider == "fall" {
+		return nil, errors.New("database has fallen")
+	}
+	return &LoginState{
+		Plaintext:    "StatePlainTextForStateTest",
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		Expiry:       time.Now().Add(ttl),
+	}, nil
+}
+
+func (m MockIdentityModel) ConsumeLoginState(statePlaintext string) (*LoginState, error) {
+	state := &LoginState{
+		Plaintext:    statePlaintext,
+		Provider:     "test",
+		Nonce:        MockOIDCNonce,
+		CodeVerifier: "mock-code-verifier",
+		Expiry:       time.Now().Add(10 * time.Minute),
+	}
+
+	switch statePlaintext[len(statePlaintext)-1] {
+	case '1':
+		return nil, ErrRecordNotFound
+	case '2':
+		return nil, errors.New("database has fallen")
+	case '3':
+		state.Provider = "removed"
+	}
+
+	return state, nil
+}
+
+func (m MockIdentityModel) DeleteExpiredLoginStates() (int64, error) {
+	return 0, nil
+}
+
+func (m MockIdentityModel) GetUser(provider, subject string) (*User, error) {
+	switch subject {
+	case "linked":
+		return &User{ID: 1, CreatedAt: time.Now(), Name: "Test", Email: "test@test.com", Activated: false, Version: 1}, nil
+	case "linked-mfa":
+		return &User{ID: 5, CreatedAt: time.Now(), Name: "Test", Email: "mfa@test.com", Activated: true, Version: 1}, nil
+	case "linked-conflict":
+		return &User{ID: 1, CreatedAt: time.Now(), Name: "Conflict", Email: "test@test.com", Activated: false, Version: 1}, nil
+	case "lookup-fall":
+		return nil, errors.New("database has fallen")
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m MockIdentityModel) GetAllForUser(userID int64) ([]*Identity, error) {
+	return []*Identity{}, nil
+}
+
+func (m MockIdentityModel) Insert(identity *Identity) error {
+	switch identity.Subject {
+	case "insert-fall":
+		return errors.New("database has fallen")
+	case "insert-duplicate":
+		return ErrDuplicateIdentity
+	}
+	identity.ID = 1
+	identity.CreatedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,311 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.bcc/internal/validator"
+)
+
+var (
+	ErrInvalidInvitation = errors.New("invalid invitation")
+)
+
+// Invitation lets someone register while registration is invite-only. It can be bound to
+// an email address, and grants a role and permissions to each user who registers with it.
+type Invitation struct {
+	ID          int64       `json:"id"`
+	Plaintext   string      `json:"code,omitempty"`
+	Hash        []byte      `json:"-"`
+	CreatedAt   time.Time   `json:"created_at"`
+	CreatedBy   int64       `json:"created_by"`
+	Email       *string     `json:"email,omitempty"`
+	Role        *string     `json:"role,omitempty"`
+	Permissions Permissions `json:"permissions"`
+	MaxUses     int         `json:"max_uses"`
+	Uses        int         `json:"uses"`
+	Expiry      *time.Time  `json:"expiry,omitempty"`
+}
+
+func ValidateInvitation(v *validator.Validator, invitation *Invitation) {
+	if invitation.Email != nil {
+		ValidateEmail(v, *invitation.Email)
+	}
+	if invitation.Role != nil {
+		v.Check(*invitation.Role != "", "role", "must not be empty")
+	}
+	v.Check(validator.Unique(invitation.Permissions), "permissions", "must not contain duplicate values")
+	v.Check(invitation.MaxUses >= 1, "max_uses", "must be at least 1")
+	v.Check(invitation.MaxUses <= 10_000, "max_uses", "must not be more than 10000")
+	if invitation.Expiry != nil {
+		v.Check(invitation.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+func ValidateInvitationCode(v *validator.Validator, code string) {
+	v.Check(code != "", "invitation", "must be provided")
+	v.Check(len(code) == 26, "invitation", "must be 26 bytes long")
+}
+
+type InvitationModel struct {
+	DB *sql.DB
+}
+
+// Insert() generates the invitation's code and stores its hash. The plaintext code is
+// only available from the invitation passed in.
+func (m InvitationModel) Insert(invitation *Invitation) error {
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+
+	invitation.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(invitation.Plaintext))
+	invitation.Hash = hash[:]
+
+	if invitation.Permissions == nil {
+		invitation.Permissions = Permissions{}
+	}
+
+	query := `
+	INSERT INTO invitations (hash, created_by, email, role, permissions, max_uses, expiry)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at`
+
+	args := []any{
+		invitation.Hash,
+		invitation.CreatedBy,
+		invitation.Email,
+		invitation.Role,
+		pq.Array(invitation.Permissions),
+		invitation.MaxUses,
+		invitation.Expiry,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "invitations" violates foreign key constraint "invitations_role_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m InvitationModel) GetAll() ([]*Invitation, error) {
+	query := `
+	SELECT id, created_at, COALESCE(created_by, 0), email, role, permissions, max_uses, uses, expiry
+	FROM invitations
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+
+	for rows.Next() {
+		var invitation Invitation
+
+		err := rows.Scan(
+			&invitation.ID,
+			&invitation.CreatedAt,
+			&invitation.CreatedBy,
+			&invitation.Email,
+			&invitation.Role,
+			pq.Array(&invitation.Permissions),
+			&invitation.MaxUses,
+			&invitation.Uses,
+			&invitation.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		invitations = append(invitations, &invitation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+func (m InvitationModel) Delete(id int64) error {
+	query := `
+	DELETE FROM invitations
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Redeem() uses up one use of the invitation to register user, in a single transaction,
+// so that an invitation can't be used more often than it allows however many people try
+// at once, and isn't used up by a registration that fails. The user gets the invitation's
+// role, or defaultRole if it doesn't have one, and its permissions. ErrInvalidInvitation
+// is returned if the code is unknown, expired, used up or bound to another email address.
+func (m InvitationModel) Redeem(code string, user *User, defaultRole string) error {
+	hash := sha256.Sum256([]byte(code))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Concurrent redemptions queue up on the row lock taken by the UPDATE, and each
+	// re-checks the use count once it gets the row.
+	query := `
+	UPDATE invitations
+	SET uses = uses + 1
+	WHERE hash = $1
+	AND uses < max_uses
+	AND (expiry IS NULL OR expiry > NOW())
+	AND (email IS NULL OR email = $2)
+	RETURNING COALESCE(role, $3), permissions`
+
+	var role string
+	var permissions Permissions
+	err = tx.QueryRowContext(ctx, query, hash[:], user.Email, defaultRole).Scan(&role, pq.Array(&permissions))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrInvalidInvitation
+		default:
+			return err
+		}
+	}
+
+	query = `
+	INSERT INTO users (name, email, password_hash, activated)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, version`
+
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	query = `
+	INSERT INTO users_roles
+	SELECT $1, roles.id FROM roles WHERE roles.name = $2`
+
+	result, err := tx.ExecContext(ctx, query, user.ID, role)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	query = `
+	INSERT INTO users_permissions
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	ON CONFLICT DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, user.ID, pq.Array(permissions))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type MockInvitationModel struct{}
+
+func (m MockInvitationModel) Insert(invitation *Invitation) error {
+	if invitation.Role != nil && *invitation.Role == "unknown" {
+		return ErrRecordNotFound
+	}
+	if invitation.MaxUses == 13 {
+		return errors.New("database has fallen")
+	}
+	invitation.ID = 1
+	invitation.Plaintext = "InvitePlainTextForInviteTe"
+	invitation.CreatedAt = time.Now()
+	if invitation.Permissions == nil {
+		invitation.Permissions = Permissions{}
+	}
+	return nil
+}
+
+func (m MockInvitationModel) GetAll() ([]*Invitation, error) {
+	return []*Invitation{
+		{ID: 1, CreatedAt: time.Now(), CreatedBy: 7, Permissions: Permissions{}, MaxUses: 1},
+	}, nil
+}
+
+func (m MockInvitationModel) Delete(id int64) error {
+	switch id {
+	case 3:
+		return ErrRecordNotFound
+	case 4:
+		return errors.New("database has fallen")
+	}
+	return nil
+}
+
+// Redeem() treats codes ending in 1 as invalid and fails for codes ending in 2. Otherwise
+// it registers the user just like MockUserModel.Insert().
+func (m MockInvitationModel) Redeem(code string, user *User, defaultRole string) error {
+	switch code[len(code)-1] {
+	case '1':
+		return ErrInvalidInvitation
+	case '2':
+		return errors.New("database has fallen")
+	}
+	return MockUserModel{}.Insert(user)
+}
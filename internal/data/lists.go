@@ -0,0 +1,653 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.bcc/internal/validator"
+)
+
+const (
+	ListKindWatchlist = "watchlist"
+	ListKindWatched   = "watched"
+	ListKindCustom    = "custom"
+)
+
+var (
+	ErrDuplicateList = errors.New("duplicate list")
+)
+
+// List is a user's list of movies in an organization. Everybody can have one watchlist and
+// one watched list, and any number of custom ones. Public lists can be read by anyone who
+// has their slug.
+type List struct {
+	ID        int64       `json:"id"`
+	UserID    int64       `json:"-"`
+	OrgID     int64       `json:"-"`
+	CreatedAt time.Time   `json:"created_at"`
+	Name      string      `json:"name"`
+	Kind      string      `json:"kind"`
+	Public    bool        `json:"public"`
+	Slug      string      `json:"slug"`
+	Version   int32       `json:"version"`
+	Items     []*ListItem `json:"items,omitempty"`
+}
+
+// ListItem is a movie on a list. Positions start at 1 and order the list.
+type ListItem struct {
+	MovieID   int64      `json:"movie_id"`
+	Position  int        `json:"position"`
+	AddedAt   time.Time  `json:"added_at"`
+	WatchedAt *time.Time `json:"watched_at,omitempty"`
+	Movie     *Movie     `json:"movie,omitempty"`
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(validator.PermittedValue(list.Kind, ListKindWatchlist, ListKindWatched, ListKindCustom), "kind", "must be one of watchlist, watched or custom")
+}
+
+func ValidateListItem(v *validator.Validator, item *ListItem) {
+	v.Check(item.Position >= 0, "position", "must not be negative")
+	if item.WatchedAt != nil {
+		v.Check(!item.WatchedAt.After(time.Now()), "watched_at", "must not be in the future")
+	}
+}
+
+type ListModel struct {
+	DB *sql.DB
+}
+
+// Insert() creates the list with a random slug, which is what makes it shareable once it
+// is public, and can't be guessed while it is private.
+func (m ListModel) Insert(list *List) error {
+	randomBytes := make([]byte, 10)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+
+	list.Slug = strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+
+	query := `
+	INSERT INTO lists (user_id, org_id, name, kind, public, slug)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, version`
+
+	args := []any{list.UserID, list.OrgID, list.Name, list.Kind, list.Public, list.Slug}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = withOrganization(ctx, m.DB, list.OrgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.Version)
+	})
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "lists_user_id_org_id_kind_idx"`:
+			return ErrDuplicateList
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get() returns one of the user's lists in the organization, without its items.
+func (m ListModel) Get(orgID, userID, id int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, user_id, org_id, created_at, name, kind, public, slug, version
+	FROM lists
+	WHERE id = $1 AND user_id = $2 AND org_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var list *List
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		var err error
+		list, err = m.scanList(tx.QueryRowContext(ctx, query, id, userID, orgID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// GetPublic() returns the public list with the slug, in whichever organization it is. It
+// runs without an organization, so only the row-level security policy for public lists
+// lets anything through.
+func (m ListModel) GetPublic(slug string) (*List, error) {
+	query := `
+	SELECT id, user_id, org_id, created_at, name, kind, public, slug, version
+	FROM lists
+	WHERE slug = $1 AND public`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.scanList(m.DB.QueryRowContext(ctx, query, slug))
+}
+
+func (m ListModel) scanList(row *sql.Row) (*List, error) {
+	var list List
+
+	err := row.Scan(
+		&list.ID,
+		&list.UserID,
+		&list.OrgID,
+		&list.CreatedAt,
+		&list.Name,
+		&list.Kind,
+		&list.Public,
+		&list.Slug,
+		&list.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &list, nil
+}
+
+// GetAll() returns the user's lists in the organization, without their items.
+func (m ListModel) GetAll(orgID, userID int64) ([]*List, error) {
+	query := `
+	SELECT id, user_id, org_id, created_at, name, kind, public, slug, version
+	FROM lists
+	WHERE user_id = $1 AND org_id = $2
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	lists := []*List{}
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, userID, orgID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var list List
+
+			err := rows.Scan(
+				&list.ID,
+				&list.UserID,
+				&list.OrgID,
+				&list.CreatedAt,
+				&list.Name,
+				&list.Kind,
+				&list.Public,
+				&list.Slug,
+				&list.Version,
+			)
+			if err != nil {
+				return err
+			}
+
+			lists = append(lists, &list)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// GetAllForUser() returns the user's lists in every organization, for their data export.
+// Items only name their movie, as the movies themselves belong to the organizations. Like
+// RatingModel.GetAllForUser() it goes through the organizations one by one, and filters on
+// each one's id as well, as their public lists would otherwise turn up in all of them.
+func (m ListModel) GetAllForUser(userID int64) ([]*List, error) {
+	query := `
+	SELECT lists.id, lists.user_id, lists.org_id, lists.created_at, lists.name, lists.kind, lists.public,
+		lists.slug, lists.version, list_items.movie_id, list_items.position, list_items.added_at,
+		list_items.watched_at
+	FROM lists
+	LEFT JOIN list_items ON list_items.list_id = lists.id
+	WHERE lists.user_id = $1 AND lists.org_id = $2
+	ORDER BY lists.id, list_items.position`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	orgIDs, err := organizationIDs(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	lists := []*List{}
+
+	for _, orgID := range orgIDs {
+		err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+			rows, err := tx.QueryContext(ctx, query, userID, orgID)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var list List
+				var movieID sql.NullInt64
+				var position sql.NullInt32
+				var addedAt sql.NullTime
+				var watchedAt *time.Time
+
+				err := rows.Scan(
+					&list.ID,
+					&list.UserID,
+					&list.OrgID,
+					&list.CreatedAt,
+					&list.Name,
+					&list.Kind,
+					&list.Public,
+					&list.Slug,
+					&list.Version,
+					&movieID,
+					&position,
+					&addedAt,
+					&watchedAt,
+				)
+				if err != nil {
+					return err
+				}
+
+				if len(lists) == 0 || lists[len(lists)-1].ID != list.ID {
+					list.Items = []*ListItem{}
+					lists = append(lists, &list)
+				}
+
+				if movieID.Valid {
+					current := lists[len(lists)-1]
+					current.Items = append(current.Items, &ListItem{
+						MovieID:   movieID.Int64,
+						Position:  int(position.Int32),
+						AddedAt:   addedAt.Time,
+						WatchedAt: watchedAt,
+					})
+				}
+			}
+
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return lists, nil
+}
+
+// Update() saves the list's name and visibility, in the same way as MovieModel.Update().
+func (m ListModel) Update(list *List) error {
+	query := `
+	UPDATE lists
+	SET name = $1, public = $2, version = version + 1
+	WHERE id = $3 AND version = $4
+	RETURNING version`
+
+	args := []any{list.Name, list.Public, list.ID, list.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := withOrganization(ctx, m.DB, list.OrgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ListModel) Delete(orgID, userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM lists
+	WHERE id = $1 AND user_id = $2 AND org_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rowsAffected int64
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id, userID, orgID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetItems() returns the list's items in order, with their movies, in one query. It runs
+// under the organization's row-level security like the rest of the movie queries.
+func (m ListModel) GetItems(orgID, listID int64) ([]*ListItem, error) {
+	query := `
+	SELECT list_items.position, list_items.added_at, list_items.watched_at,
+		movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+		movies.version, movies.average_rating, movies.rating_count
+	FROM list_items
+	INNER JOIN movies ON movies.id = list_items.movie_id
+	WHERE list_items.list_id = $1 AND movies.deleted_at IS NULL
+	ORDER BY list_items.position`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	items := []*ListItem{}
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, listID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var item ListItem
+			var movie Movie
+
+			err := rows.Scan(
+				&item.Position,
+				&item.AddedAt,
+				&item.WatchedAt,
+				&movie.ID,
+				&movie.CreatedAt,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pq.Array(&movie.Genres),
+				&movie.Version,
+				&movie.AverageRating,
+				&movie.RatingCount,
+			)
+			if err != nil {
+				return err
+			}
+
+			item.MovieID = movie.ID
+			item.Movie = &movie
+			items = append(items, &item)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// SetItem() puts the movie on the list at item.Position, or at the end if that is 0 or
+// past the end, moving it if it is already there. The items after it shift down to make
+// room. A movie that is already on the list keeps when it was added, and its watched_at
+// unless the item has a new one. ErrRecordNotFound is returned if the movie isn't in the
+// organization.
+func (m ListModel) SetItem(orgID, listID int64, item *ListItem) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		// Locking the list makes changes to its order happen one at a time.
+		_, err := tx.ExecContext(ctx, `SELECT id FROM lists WHERE id = $1 FOR UPDATE`, listID)
+		if err != nil {
+			return err
+		}
+
+		var exists bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM movies WHERE id = $1 AND deleted_at IS NULL)`, item.MovieID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrRecordNotFound
+		}
+
+		var oldPosition int
+		var addedAt time.Time
+		var watchedAt *time.Time
+
+		query := `
+		DELETE FROM list_items
+		WHERE list_id = $1 AND movie_id = $2
+		RETURNING position, added_at, watched_at`
+
+		err = tx.QueryRowContext(ctx, query, listID, item.MovieID).Scan(&oldPosition, &addedAt, &watchedAt)
+		switch {
+		case err == nil:
+			_, err = tx.ExecContext(ctx, `UPDATE list_items SET position = position - 1 WHERE list_id = $1 AND position > $2`, listID, oldPosition)
+			if err != nil {
+				return err
+			}
+		case errors.Is(err, sql.ErrNoRows):
+			addedAt = time.Now()
+		default:
+			return err
+		}
+
+		var end int
+		err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(position), 0) + 1 FROM list_items WHERE list_id = $1`, listID).Scan(&end)
+		if err != nil {
+			return err
+		}
+		if item.Position < 1 || item.Position > end {
+			item.Position = end
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE list_items SET position = position + 1 WHERE list_id = $1 AND position >= $2`, listID, item.Position)
+		if err != nil {
+			return err
+		}
+
+		if item.WatchedAt == nil {
+			item.WatchedAt = watchedAt
+		}
+		item.AddedAt = addedAt
+
+		query = `
+		INSERT INTO list_items (list_id, movie_id, position, added_at, watched_at)
+		VALUES ($1, $2, $3, $4, $5)`
+
+		_, err = tx.ExecContext(ctx, query, listID, item.MovieID, item.Position, item.AddedAt, item.WatchedAt)
+		return err
+	})
+}
+
+// RemoveItem() takes the movie off the list, and closes the gap it leaves.
+func (m ListModel) RemoveItem(orgID, listID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `SELECT id FROM lists WHERE id = $1 FOR UPDATE`, listID)
+		if err != nil {
+			return err
+		}
+
+		var position int
+		err = tx.QueryRowContext(ctx, `DELETE FROM list_items WHERE list_id = $1 AND movie_id = $2 RETURNING position`, listID, movieID).Scan(&position)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE list_items SET position = position - 1 WHERE list_id = $1 AND position > $2`, listID, position)
+		return err
+	})
+}
+
+type MockListModel struct{}
+
+func (m MockListModel) Insert(list *List) error {
+	switch list.Name {
+	case "Duplicate":
+		return ErrDuplicateList
+	case "fall":
+		return errors.New("database falls")
+	}
+	list.ID = 1
+	list.Slug = "mockslug"
+	list.CreatedAt = time.Now()
+	list.Version = 1
+	return nil
+}
+
+// Get() returns a custom list for id 1, the watched list for id 4 and a custom list whose
+// items can't be read for id 5. They are all in organization 1, and as with row-level
+// security other organizations can't see them.
+func (m MockListModel) Get(orgID, userID, id int64) (*List, error) {
+	if orgID != 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	list := &List{
+		ID:        id,
+		UserID:    userID,
+		OrgID:     orgID,
+		CreatedAt: time.Now(),
+		Name:      "Test list",
+		Kind:      ListKindCustom,
+		Slug:      "mockslug",
+		Version:   1,
+	}
+
+	switch id {
+	case 1, 5:
+	case 2:
+		return nil, errors.New("database falls")
+	case 4:
+		list.Kind = ListKindWatched
+	default:
+		return nil, ErrRecordNotFound
+	}
+
+	return list, nil
+}
+
+func (m MockListModel) GetPublic(slug string) (*List, error) {
+	switch slug {
+	case "public":
+		return &List{ID: 1, UserID: 1, OrgID: 1, CreatedAt: time.Now(), Name: "Public list", Kind: ListKindCustom, Public: true, Slug: slug, Version: 1}, nil
+	case "items-fall":
+		return &List{ID: 5, UserID: 1, OrgID: 1, CreatedAt: time.Now(), Name: "Public list", Kind: ListKindCustom, Public: true, Slug: slug, Version: 1}, nil
+	case "fall":
+		return nil, errors.New("database falls")
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m MockListModel) GetAll(orgID, userID int64) ([]*List, error) {
+	if userID == 2 {
+		return nil, errors.New("database falls")
+	}
+	return []*List{}, nil
+}
+
+func (m MockListModel) GetAllForUser(userID int64) ([]*List, error) {
+	return []*List{}, nil
+}
+
+func (m MockListModel) Update(list *List) error {
+	switch list.Name {
+	case "Conflict":
+		return ErrEditConflict
+	case "fall":
+		return errors.New("database falls")
+	}
+	list.Version++
+	return nil
+}
+
+func (m MockListModel) Delete(orgID, userID, id int64) error {
+	switch id {
+	case 1:
+		return nil
+	case 2:
+		return errors.New("database falls")
+	}
+	return ErrRecordNotFound
+}
+
+func (m MockListModel) GetItems(orgID, listID int64) ([]*ListItem, error) {
+	if listID == 5 {
+		return nil, errors.New("database falls")
+	}
+	return []*ListItem{
+		{MovieID: 1, Position: 1, AddedAt: time.Now(), Movie: &Movie{ID: 1, Title: "Test Mock", Year: 2023, Runtime: 105, Genres: []string{"drama"}, Version: 1}},
+	}, nil
+}
+
+func (m MockListModel) SetItem(orgID, listID int64, item *ListItem) error {
+	switch item.MovieID {
+	case 1:
+		if item.Position == 0 {
+			item.Position = 1
+		}
+		item.AddedAt = time.Now()
+		return nil
+	case 2:
+		return errors.New("database falls")
+	}
+	return ErrRecordNotFound
+}
+
+func (m MockListModel) RemoveItem(orgID, listID, movieID int64) error {
+	switch movieID {
+	case 1:
+		return nil
+	case 2:
+		return errors.New("database falls")
+	}
+	return ErrRecordNotFound
+}
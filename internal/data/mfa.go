@@ -0,0 +1,338 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"greenlight.bcc/internal/validator"
+)
+
+type TOTP struct {
+	UserID       int64      `json:"-"`
+	Secret       string     `json:"-"`
+	CreatedAt    time.Time  `json:"-"`
+	ConfirmedAt  *time.Time `json:"-"`
+	LastUsedStep int64      `json:"-"`
+}
+
+// Confirmed reports whether the user has proved they can generate codes for the secret.
+// Until then the secret doesn't protect the account.
+func (t *TOTP) Confirmed() bool {
+	return t.ConfirmedAt != nil
+}
+
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) == 6, "code", "must be 6 digits long")
+	v.Check(strings.Trim(code, "0123456789") == "", "code", "must only contain digits")
+}
+
+func ValidateRecoveryCode(v *validator.Validator, code string) {
+	v.Check(code != "", "recovery_code", "must be provided")
+	v.Check(len(code) == 11, "recovery_code", "must be 11 bytes long")
+}
+
+// generateRecoveryCode returns a code such as "ABCDE-FGHIJ" and its hash.
+func generateRecoveryCode() (string, []byte, error) {
+	randomBytes := make([]byte, 10)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)[:10]
+	code = code[:5] + "-" + code[5:]
+
+	return code, hashRecoveryCode(code), nil
+}
+
+func hashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(strings.ToUpper(code)))
+	return hash[:]
+}
+
+type MFAModel struct {
+	DB *sql.DB
+}
+
+func (m MFAModel) GetTOTP(userID int64) (*TOTP, error) {
+	query := `
+	SELECT user_id, secret, created_at, confirmed_at, last_used_step
+	FROM totp_secrets
+	WHERE user_id = $1`
+
+	var totp TOTP
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&totp.CreatedAt,
+		&totp.ConfirmedAt,
+		&totp.LastUsedStep,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &totp, nil
+}
+
+// SetTOTP() stores a new, unconfirmed secret for the user. An enrolment that was never
+// confirmed is replaced, but a confirmed one is left alone and ErrEditConflict returned.
+func (m MFAModel) SetTOTP(userID int64, secret string) error {
+	query := `
+	INSERT INTO totp_secrets (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+	WHERE totp_secrets.confirmed_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func (m MFAModel) ConfirmTOTP(userID int64) error {
+	query := `
+	UPDATE totp_secrets
+	SET confirmed_at = NOW()
+	WHERE user_id = $1 AND confirmed_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// UseTOTPStep() records that the code for the given time step has been used. It returns
+// ErrEditConflict if that step, or a later one, was already used, so a code that has been
+// seen once can't be replayed.
+func (m MFAModel) UseTOTPStep(userID, step int64) error {
+	query := `
+	UPDATE totp_secrets
+	SET last_used_step = $2
+	WHERE user_id = $1 AND last_used_step < $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// DeleteTOTP() removes the user's secret along with any recovery codes.
+func (m MFAModel) DeleteTOTP(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM totp_secrets WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+// NewRecoveryCodes() replaces the user's recovery codes with n new ones and returns their
+// plaintext. Only the hashes are stored, so this is the only time they can be shown.
+func (m MFAModel) NewRecoveryCodes(userID int64, n int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		code, hash, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, tx.Commit()
+}
+
+// UseRecoveryCode() marks an unused recovery code as used. ErrRecordNotFound is returned if
+// the code doesn't exist or has already been used.
+func (m MFAModel) UseRecoveryCode(userID int64, code string) error {
+	query := `
+	UPDATE recovery_codes
+	SET used_at = NOW()
+	WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// MockTOTPSecret is the secret the mock model holds for users 5 (confirmed) and 6
+// (enrolment in progress).
+const MockTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+type MockMFAModel struct{}
+
+func (m MockMFAModel) GetTOTP(userID int64) (*TOTP, error) {
+	switch userID {
+	case 2:
+		return nil, errors.New("error occurred")
+	case 5:
+		confirmedAt := time.Now()
+		return &TOTP{UserID: userID, Secret: MockTOTPSecret, CreatedAt: time.Now(), ConfirmedAt: &confirmedAt}, nil
+	case 6:
+		return &TOTP{UserID: userID, Secret: MockTOTPSecret, CreatedAt: time.Now()}, nil
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m MockMFAModel) SetTOTP(userID int64, secret string) error {
+	switch userID {
+	case 2:
+		return errors.New("error occurred")
+	case 5:
+		return ErrEditConflict
+	}
+	return nil
+}
+
+func (m MockMFAModel) ConfirmTOTP(userID int64) error {
+	if userID == 2 {
+		return errors.New("error occurred")
+	}
+	return nil
+}
+
+func (m MockMFAModel) UseTOTPStep(userID, step int64) error {
+	return nil
+}
+
+func (m MockMFAModel) DeleteTOTP(userID int64) error {
+	switch userID {
+	case 2:
+		return errors.New("error occurred")
+	case 5, 6:
+		return nil
+	}
+	return ErrRecordNotFound
+}
+
+func (m MockMFAModel) NewRecoveryCodes(userID int64, n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		code, _, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func (m MockMFAModel) UseRecoveryCode(userID int64, code string) error {
+	if strings.ToUpper(code) != "AAAAA-BBBBB" {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
@@ -13,34 +14,162 @@ var (
 
 type Models struct {
 	Movies interface {
-		Insert(movie *Movie) error
-		Get(id int64) (*Movie, error)
-		Update(movie *Movie) error
-		Delete(id int64) error
-		GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+		Insert(orgID, userID int64, movie *Movie) error
+		Get(orgID, id int64) (*Movie, error)
+		GetIncludingDeleted(orgID, id int64) (*Movie, error)
+		Update(orgID, userID int64, movie *Movie) error
+		Delete(orgID, userID, id int64) error
+		GetAll(orgID int64, search MovieSearch, filters Filters) ([]*Movie, Metadata, error)
+		SetImage(orgID, movieID int64, kind, key string) (*Image, error)
+		SetImageThumbnails(orgID, movieID int64, kind, key string) error
+		GetDeleted(orgID int64, filters Filters) ([]*Movie, Metadata, error)
+		Restore(orgID, userID, id int64) error
+		PurgeDeleted(before time.Time) ([]*Movie, error)
+		Import(orgID, userID int64, movies []*Movie) error
+		Export(ctx context.Context, orgID int64, search MovieSearch, fn func(movie *Movie) error) error
+	}
+	MovieRevisions interface {
+		GetAllForMovie(orgID, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error)
+		GetVersion(orgID, movieID int64, version int32) (*Movie, error)
+	}
+	Ratings interface {
+		Set(orgID int64, rating *Rating) error
+		Delete(orgID, movieID, userID int64) error
+		GetAllForUser(userID int64) ([]*Rating, error)
+	}
+	Reviews interface {
+		Insert(orgID int64, review *Review) error
+		Get(orgID, movieID, id int64) (*Review, error)
+		GetAllForMovie(orgID, movieID int64, includeHidden bool, filters Filters) ([]*Review, Metadata, error)
+		GetAllForUser(userID int64) ([]*Review, error)
+		Update(orgID int64, review *Review) error
+		SetHidden(orgID, id int64, hidden bool) error
+		Delete(orgID, id int64) error
+		Report(report *ReviewReport) error
+		GetReports(orgID int64, filters Filters) ([]*ReviewReport, Metadata, error)
+		ResolveReports(reviewID int64) error
+	}
+	Lists interface {
+		Insert(list *List) error
+		Get(orgID, userID, id int64) (*List, error)
+		GetPublic(slug string) (*List, error)
+		GetAll(orgID, userID int64) ([]*List, error)
+		GetAllForUser(userID int64) ([]*List, error)
+		Update(list *List) error
+		Delete(orgID, userID, id int64) error
+		GetItems(orgID, listID int64) ([]*ListItem, error)
+		SetItem(orgID, listID int64, item *ListItem) error
+		RemoveItem(orgID, listID, movieID int64) error
+	}
+	People interface {
+		Insert(orgID int64, person *Person) error
+		Get(orgID, id int64) (*Person, error)
+		Update(orgID int64, person *Person) error
+		Delete(orgID, id int64) error
+		GetAll(orgID int64, name string, filters Filters) ([]*Person, Metadata, error)
+	}
+	Credits interface {
+		Insert(orgID int64, credit *Credit) error
+		GetForMovie(orgID, movieID int64) ([]*Credit, error)
+		Delete(orgID, movieID, id int64) error
+	}
+	Organizations interface {
+		Insert(org *Organization, ownerID int64) error
+		GetForUser(slug string, userID int64) (*Organization, error)
+		GetAllForUser(userID int64) ([]*Organization, error)
+		GetMembers(orgID int64) ([]*Member, error)
+		GetRole(orgID, userID int64) (string, error)
+		SetMember(slug string, userID int64, role string) error
+		RemoveMember(orgID, userID int64) error
 	}
 	Users interface {
 		Insert(user *User) error
+		Get(id int64) (*User, error)
+		GetAll(search string, activated *bool, filters Filters) ([]*User, Metadata, error)
 		GetByEmail(email string) (*User, error)
 		Update(user *User) error
 		GetForToken(tokenScope, tokenPlaintext string) (*User, error)
+		SetSuspended(user *User, suspended bool, audit *AuditEntry) error
+		SoftDelete(user *User) error
+		PurgeDeleted(before time.Time) (int64, error)
 	}
 	Tokens interface {
 		DeleteAllForUser(scope string, userID int64) error
+		RevokeAllForUser(userID int64, audit *AuditEntry) error
+		DeleteByPlaintext(scope, tokenPlaintext string) error
+		DeleteSessionByPlaintext(tokenPlaintext string) error
+		DeleteForUser(id, userID int64) error
+		GetAllForUser(userID int64, scopes ...string) ([]*Token, error)
+		GetByPlaintext(scope, tokenPlaintext string) (*Token, error)
 		Insert(token *Token) error
 		New(userID int64, ttl time.Duration, scope string) (*Token, error)
+		NewSession(userID int64, ttl time.Duration, scope, userAgent, ip string, sessionID int64) (*Token, error)
+		Rotate(token *Token) error
+		UpdateLastUsed(scope, tokenPlaintext string) error
+	}
+	APIKeys interface {
+		New(userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error)
+		Insert(key *APIKey) error
+		GetForPlaintext(keyPlaintext string) (*APIKey, error)
+		GetAllForUser(userID int64) ([]*APIKey, error)
+		DeleteForUser(id, userID int64) error
+		UpdateLastUsed(id int64) error
+	}
+	MFA interface {
+		GetTOTP(userID int64) (*TOTP, error)
+		SetTOTP(userID int64, secret string) error
+		ConfirmTOTP(userID int64) error
+		UseTOTPStep(userID, step int64) error
+		DeleteTOTP(userID int64) error
+		NewRecoveryCodes(userID int64, n int) ([]string, error)
+		UseRecoveryCode(userID int64, code string) error
+	}
+	LoginThrottles interface {
+		Get(email string) (*LoginThrottle, error)
+		RecordFailure(email string, policy LockoutPolicy) (*LoginThrottle, bool, error)
+		Reset(email string, audit *AuditEntry) error
+	}
+	Identities interface {
+		NewLoginState(provider, nonce, codeVerifier string, ttl time.Duration) (*LoginState, error)
+		ConsumeLoginState(statePlaintext string) (*LoginState, error)
+		DeleteExpiredLoginStates() (int64, error)
+		GetUser(provider, subject string) (*User, error)
+		GetAllForUser(userID int64) ([]*Identity, error)
+		Insert(identity *Identity) error
+	}
+	Invitations interface {
+		Insert(invitation *Invitation) error
+		GetAll() ([]*Invitation, error)
+		Delete(id int64) error
+		Redeem(code string, user *User, defaultRole string) error
 	}
 	Permissions interface {
 		GetAllForUser(userID int64) (Permissions, error)
-		AddForUser(userID int64, codes ...string) error
+		GetAll() (Permissions, error)
+		AddForUser(userID int64, audit *AuditEntry, codes ...string) error
+		RemoveForUser(userID int64, audit *AuditEntry, codes ...string) error
+		GetRolesForUser(userID int64) ([]string, error)
+		AddRolesForUser(userID int64, roles ...string) error
 	}
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
 		Movies: MovieModel{DB: db},
+		MovieRevisions: MovieRevisionModel{DB: db},
+		Ratings: RatingModel{DB: db},
+		Reviews: ReviewModel{DB: db},
+		Lists: ListModel{DB: db},
+		People: PersonModel{DB: db},
+		Credits: CreditModel{DB: db},
+		Organizations: OrganizationModel{DB: db},
 		Users: UserModel{DB: db},
 		Tokens: TokenModel{DB:db},
+		APIKeys: APIKeyModel{DB: db},
+		MFA: MFAModel{DB: db},
+		LoginThrottles: LoginThrottleModel{DB: db},
+		Identities: IdentityModel{DB: db},
+		Invitations: InvitationModel{DB: db},
 		Permissions: PermissionModel{DB: db},
 	}
 }
@@ -48,8 +177,20 @@ func NewModels(db *sql.DB) Models {
 func NewMockModels() Models {
 	return Models{
 	Movies: MockMovieModel{},
+	MovieRevisions: MockMovieRevisionModel{},
+	Ratings: MockRatingModel{},
+	Reviews: MockReviewModel{},
+	Lists: MockListModel{},
+	People: MockPersonModel{},
+	Credits: MockCreditModel{},
+	Organizations: MockOrganizationModel{},
 	Users: MockUserModel{},
 	Tokens: MockTokenModel{},
+	APIKeys: MockAPIKeyModel{},
+	MFA: MockMFAModel{},
+	LoginThrottles: MockLoginThrottleModel{},
+	Identities: MockIdentityModel{},
+	Invitations: MockInvitationModel{},
 	Permissions: MockPermissionModel{},
 	}
 }
@@ -9,6 +9,8 @@ import "github.com/lib/pq"
 import "errors"
 import "context"
 import "fmt"
+import "path"
+import "strings"
 
 type Movie struct {
 	ID        int64     `json:"id"`
@@ -18,6 +20,99 @@ type Movie struct {
 	Runtime   Runtime   `json:"runtime,omitempty"`
 	Genres    []string  `json:"genres,omitempty"`
 	Version   int32     `json:"version"`
+
+	AverageRating float64 `json:"average_rating"`
+	RatingCount   int32   `json:"rating_count"`
+
+	Credits []*Credit `json:"credits,omitempty"`
+
+	Poster   *Image `json:"poster,omitempty"`
+	Backdrop *Image `json:"backdrop,omitempty"`
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+const (
+	ImagePoster   = "poster"
+	ImageBackdrop = "backdrop"
+)
+
+var ImageKinds = []string{ImagePoster, ImageBackdrop}
+
+// ThumbnailWidths are the widths in pixels of the thumbnails generated for each kind of
+// image. Posters are shown in grids and need more sizes than backdrops.
+var ThumbnailWidths = map[string][]int{
+	ImagePoster:   {92, 185, 342},
+	ImageBackdrop: {300, 780},
+}
+
+// Image is an image of a movie in the blob store. The URLs are filled in by the handler
+// from the keys, because only the store knows where its files can be downloaded from.
+type Image struct {
+	Key           string            `json:"-"`
+	HasThumbnails bool              `json:"-"`
+	URL           string            `json:"url"`
+	Thumbnails    map[string]string `json:"thumbnails,omitempty"`
+}
+
+// ThumbnailKey returns the key of the thumbnail of the image which is width pixels wide.
+// Thumbnails are always JPEGs, whatever the format of the original.
+func ThumbnailKey(key string, width int) string {
+	return fmt.Sprintf("%s-w%d.jpg", strings.TrimSuffix(key, path.Ext(key)), width)
+}
+
+// Keys returns the keys of the image and any thumbnails it has.
+func (image *Image) Keys(kind string) []string {
+	keys := []string{image.Key}
+	if image.HasThumbnails {
+		for _, width := range ThumbnailWidths[kind] {
+			keys = append(keys, ThumbnailKey(image.Key, width))
+		}
+	}
+	return keys
+}
+
+func (movie *Movie) setImages(poster, backdrop Image) {
+	if poster.Key != "" {
+		movie.Poster = &poster
+	}
+	if backdrop.Key != "" {
+		movie.Backdrop = &backdrop
+	}
+}
+
+// MovieSearch holds the conditions the movies returned by GetAll() must meet. Zero values
+// match every movie.
+type MovieSearch struct {
+	Title          string
+	Genres         []string
+	MinRating      int
+	MinRatingCount int
+	PersonID       int64
+	Role           string
+}
+
+// movieSearchConditions is the WHERE clause which applies a MovieSearch, taking the
+// arguments returned by its args() as $1 to $6. Movies in the trash never match.
+const movieSearchConditions = `deleted_at IS NULL
+	AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+	AND (genres @> $2 OR $2 = '{}')
+	AND average_rating >= $3
+	AND rating_count >= $4
+	AND (EXISTS (
+		SELECT 1 FROM credits
+		WHERE credits.movie_id = movies.id AND credits.person_id = $5 AND (credits.role = $6 OR $6 = '')
+	) OR $5 = 0)`
+
+func (search MovieSearch) args() []any {
+	return []any{
+		search.Title,
+		pq.Array(search.Genres),
+		search.MinRating,
+		search.MinRatingCount,
+		search.PersonID,
+		search.Role,
+	}
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
@@ -38,45 +133,69 @@ type MovieModel struct {
 	DB *sql.DB
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
+// Insert() adds the movie, recording userID as the one who created it.
+func (m MovieModel) Insert(orgID, userID int64, movie *Movie) error {
 	query := `
-INSERT INTO movies (title, year, runtime, genres)
-VALUES ($1, $2, $3, $4)
+INSERT INTO movies (org_id, title, year, runtime, genres)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING id, created_at, version`
 
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	args := []any{orgID, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	return withActor(ctx, m.DB, orgID, userID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	})
 }
 
 // Add a placeholder method for fetching a specific record from the movies table.
-func (m MovieModel) Get(id int64) (*Movie, error) {
+func (m MovieModel) Get(orgID, id int64) (*Movie, error) {
+	return m.get(orgID, id, false)
+}
+
+// GetIncludingDeleted() is Get() for movies which may be in the trash, for the things
+// which still apply to them, such as their history.
+func (m MovieModel) GetIncludingDeleted(orgID, id int64) (*Movie, error) {
+	return m.get(orgID, id, true)
+}
+
+func (m MovieModel) get(orgID, id int64, includeDeleted bool) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT id, created_at, title, year, runtime, genres, version, average_rating, rating_count,
+			poster_key, poster_thumbnails, backdrop_key, backdrop_thumbnails, deleted_at
 		FROM movies
-		WHERE id = $1`
+		WHERE id = $1 AND (deleted_at IS NULL OR $2)`
 
 	var movie Movie
+	var poster, backdrop Image
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&movie.ID,
-		&movie.CreatedAt,
-		&movie.Title,
-		&movie.Year,
-		&movie.Runtime,
-		pq.Array(&movie.Genres),
-		&movie.Version,
-	)
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, id, includeDeleted).Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&poster.Key,
+			&poster.HasThumbnails,
+			&backdrop.Key,
+			&backdrop.HasThumbnails,
+			&movie.DeletedAt,
+		)
+	})
 
 	if err != nil {
 		switch {
@@ -87,15 +206,17 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		}
 	}
 
+	movie.setImages(poster, backdrop)
+
 	return &movie, nil
 }
 
 // Add a placeholder method for updating a specific record in the movies table.
-func (m MovieModel) Update(movie *Movie) error {
+func (m MovieModel) Update(orgID, userID int64, movie *Movie) error {
 	query := `
 UPDATE movies
 SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-WHERE id = $5 AND version = $6
+WHERE id = $5 AND version = $6 AND deleted_at IS NULL
 RETURNING version`
 
 	args := []any{
@@ -110,7 +231,9 @@ RETURNING version`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	err := withActor(ctx, m.DB, orgID, userID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -123,25 +246,224 @@ RETURNING version`
 	return nil
 }
 
-// Add a placeholder method for deleting a specific record from the movies table.
-func (m MovieModel) Delete(id int64) error {
+// Delete() moves the movie to the trash. It is hidden from everything but GetDeleted()
+// until it is restored, or PurgeDeleted() removes it for good.
+func (m MovieModel) Delete(orgID, userID, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
-	DELETE FROM movies
-	WHERE id = $1`
+	UPDATE movies
+	SET deleted_at = NOW()
+	WHERE id = $1 AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	var rowsAffected int64
+	err := withActor(ctx, m.DB, orgID, userID, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err = result.RowsAffected()
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll() returns the movies matching the search. Unrated movies have an average rating
+// of 0, and a person matches any of their credits unless the search names a role.
+func (m MovieModel) GetAll(orgID int64, search MovieSearch, filters Filters) ([]*Movie, Metadata, error) {
+	// "rating" is easier to use in the sort parameter than the name of the column.
+	sortColumn := filters.sortColumn()
+	if sortColumn == "rating" {
+		sortColumn = "average_rating"
+	}
+
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, average_rating, rating_count,
+		poster_key, poster_thumbnails, backdrop_key, backdrop_thumbnails
+	FROM movies
+	WHERE %s
+	ORDER BY %s %s, id ASC
+	LIMIT $7 OFFSET $8`, movieSearchConditions, sortColumn, filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := append(search.args(), filters.limit(), filters.offset())
+
+	movies := []*Movie{}
+
+	totalRecords := 0
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var movie Movie
+			var poster, backdrop Image
+
+			err := rows.Scan(
+				&totalRecords,
+				&movie.ID,
+				&movie.CreatedAt,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pq.Array(&movie.Genres),
+				&movie.Version,
+				&movie.AverageRating,
+				&movie.RatingCount,
+				&poster.Key,
+				&poster.HasThumbnails,
+				&backdrop.Key,
+				&backdrop.HasThumbnails,
+			)
+			if err != nil {
+				return err
+			}
+
+			movie.setImages(poster, backdrop)
+			movies = append(movies, &movie)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+// Export() calls fn with each movie matching the search, in order of ID, as it is read
+// from the database, so that exporting a large catalogue doesn't mean holding it all in
+// memory. It has no timeout of its own: the query runs until it finishes, fn returns an
+// error or ctx is cancelled. Images and credits aren't included.
+func (m MovieModel) Export(ctx context.Context, orgID int64, search MovieSearch, fn func(movie *Movie) error) error {
+	query := fmt.Sprintf(`
+	SELECT id, created_at, title, year, runtime, genres, version, average_rating, rating_count
+	FROM movies
+	WHERE %s
+	ORDER BY id ASC`, movieSearchConditions)
+
+	return withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, search.args()...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var movie Movie
+
+			err := rows.Scan(
+				&movie.ID,
+				&movie.CreatedAt,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pq.Array(&movie.Genres),
+				&movie.Version,
+				&movie.AverageRating,
+				&movie.RatingCount,
+			)
+			if err != nil {
+				return err
+			}
+
+			err = fn(&movie)
+			if err != nil {
+				return err
+			}
+		}
+
+		return rows.Err()
+	})
+}
+
+// SetImage() replaces the movie's image of the given kind with the one stored under key,
+// or removes it if key is empty. It returns the image which was replaced, if there was
+// one, so that its files can be deleted.
+func (m MovieModel) SetImage(orgID, movieID int64, kind, key string) (*Image, error) {
+	if !validator.PermittedValue(kind, ImageKinds...) {
+		return nil, fmt.Errorf("unknown image kind %q", kind)
+	}
+
+	query := fmt.Sprintf(`
+	UPDATE movies
+	SET %[1]s_key = $1, %[1]s_thumbnails = false
+	FROM (SELECT id, %[1]s_key, %[1]s_thumbnails FROM movies WHERE id = $2 AND deleted_at IS NULL FOR UPDATE) old
+	WHERE movies.id = old.id
+	RETURNING old.%[1]s_key, old.%[1]s_thumbnails`, kind)
+
+	var old Image
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, key, movieID).Scan(&old.Key, &old.HasThumbnails)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if old.Key == "" {
+		return nil, nil
+	}
+
+	return &old, nil
+}
+
+// SetImageThumbnails() records that the thumbnails of the image stored under key have
+// been generated. ErrRecordNotFound is returned if the movie no longer has that image.
+func (m MovieModel) SetImageThumbnails(orgID, movieID int64, kind, key string) error {
+	if !validator.PermittedValue(kind, ImageKinds...) {
+		return fmt.Errorf("unknown image kind %q", kind)
+	}
+
+	query := fmt.Sprintf(`
+	UPDATE movies
+	SET %[1]s_thumbnails = true
+	WHERE id = $1 AND %[1]s_key = $2`, kind)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rowsAffected int64
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, movieID, key)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err = result.RowsAffected()
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -153,62 +475,223 @@ func (m MovieModel) Delete(id int64) error {
 	return nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// GetDeleted() returns the movies in the organization's trash, most recently deleted
+// first unless filters says otherwise.
+func (m MovieModel) GetDeleted(orgID int64, filters Filters) ([]*Movie, Metadata, error) {
 	query := fmt.Sprintf(`
-	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, average_rating, rating_count, deleted_at
 	FROM movies
-	WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-	AND (genres @> $2 OR $2 = '{}')
+	WHERE deleted_at IS NOT NULL
 	ORDER BY %s %s, id ASC
-	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
+	movies := []*Movie{}
+	totalRecords := 0
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, filters.limit(), filters.offset())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var movie Movie
+
+			err := rows.Scan(
+				&totalRecords,
+				&movie.ID,
+				&movie.CreatedAt,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pq.Array(&movie.Genres),
+				&movie.Version,
+				&movie.AverageRating,
+				&movie.RatingCount,
+				&movie.DeletedAt,
+			)
+			if err != nil {
+				return err
+			}
+
+			movies = append(movies, &movie)
+		}
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+		return rows.Err()
+	})
 	if err != nil {
 		return nil, Metadata{}, err
 	}
-	defer rows.Close()
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+// Restore() takes the movie back out of the trash.
+func (m MovieModel) Restore(orgID, userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	UPDATE movies
+	SET deleted_at = NULL
+	WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rowsAffected int64
+	err := withActor(ctx, m.DB, orgID, userID, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PurgeDeleted() permanently deletes movies that were moved to the trash before the given
+// time, along with their credits, ratings, reviews and list entries. Row-level security
+// only lets us see one organization's movies at a time, so it goes through them one by
+// one. The purged movies are returned so that their images can be deleted too.
+func (m MovieModel) PurgeDeleted(before time.Time) ([]*Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	orgIDs, err := organizationIDs(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	DELETE FROM movies
+	WHERE deleted_at < $1
+	RETURNING id, poster_key, poster_thumbnails, backdrop_key, backdrop_thumbnails`
 
 	movies := []*Movie{}
 
-	totalRecords := 0
+	for _, orgID := range orgIDs {
+		err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+			rows, err := tx.QueryContext(ctx, query, before)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var movie Movie
+				var poster, backdrop Image
+
+				err := rows.Scan(&movie.ID, &poster.Key, &poster.HasThumbnails, &backdrop.Key, &backdrop.HasThumbnails)
+				if err != nil {
+					return err
+				}
+
+				movie.setImages(poster, backdrop)
+				movies = append(movies, &movie)
+			}
+
+			return rows.Err()
+		})
+		if err != nil {
+			return movies, err
+		}
+	}
 
-	for rows.Next() {
-		var movie Movie
+	return movies, nil
+}
 
-		err := rows.Scan(
-			&totalRecords,
-			&movie.ID,
-			&movie.CreatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			pq.Array(&movie.Genres),
-			&movie.Version,
-		)
+// importBatchSize is the number of movies Import() copies to the database at a time.
+const importBatchSize = 1000
+
+// Import() inserts many movies at once, all in one transaction, so that either every movie
+// is added or none are. Postgres won't COPY into a table with row-level security, so each
+// batch is copied into a temporary table and moved into movies with an INSERT, which the
+// policy checks as usual and which records revisions like Insert() does.
+func (m MovieModel) Import(orgID, userID int64, movies []*Movie) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return withActor(ctx, m.DB, orgID, userID, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+		CREATE TEMPORARY TABLE movie_imports (title text, year integer, runtime integer, genres text[])
+		ON COMMIT DROP`)
 		if err != nil {
-			return nil, Metadata{}, err
+			return err
+		}
+
+		for start := 0; start < len(movies); start += importBatchSize {
+			end := start + importBatchSize
+			if end > len(movies) {
+				end = len(movies)
+			}
+
+			err := copyMovies(ctx, tx, movies[start:end])
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			INSERT INTO movies (org_id, title, year, runtime, genres)
+			SELECT $1, title, year, runtime, genres FROM movie_imports`, orgID)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `TRUNCATE movie_imports`)
+			if err != nil {
+				return err
+			}
 		}
 
-		movies = append(movies, &movie)
+		return nil
+	})
+}
+
+// copyMovies copies the movies into the movie_imports table. The rows are buffered by the
+// statement and sent when it is executed with no arguments.
+func copyMovies(ctx context.Context, tx *sql.Tx, movies []*Movie) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("movie_imports", "title", "year", "runtime", "genres"))
+	if err != nil {
+		return err
 	}
+	defer stmt.Close()
 
-	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+	for _, movie := range movies {
+		_, err = stmt.ExecContext(ctx, movie.Title, movie.Year, int32(movie.Runtime), pq.Array(movie.Genres))
+		if err != nil {
+			return err
+		}
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
 
-	return movies, metadata, nil
+	return stmt.Close()
 }
 
 type MockMovieModel struct{}
 
-func (m MockMovieModel) Insert(movie *Movie) error {
+func (m MockMovieModel) Insert(orgID, userID int64, movie *Movie) error {
 	switch movie.Title {
 	case "Repeated Title":
 		return ErrDuplicateEmail
@@ -217,7 +700,7 @@ func (m MockMovieModel) Insert(movie *Movie) error {
 	}
 }
 
-func (m MockMovieModel) Get(id int64) (*Movie, error) {
+func (m MockMovieModel) Get(orgID, id int64) (*Movie, error) {
 	switch id {
 	case 1:
 		return &Movie{
@@ -227,14 +710,34 @@ func (m MockMovieModel) Get(id int64) (*Movie, error) {
 			Runtime:   105,
 			Title:     "Test Mock",
 			Genres:    []string{""},
+			Poster:    &Image{Key: "movies/1/poster-mock.png", HasThumbnails: true},
 		}, nil
 	case 2:
 		return nil, errors.New("database falls")
+	case 5:
+		return &Movie{
+			ID:        5,
+			CreatedAt: time.Now(),
+			Year:      2023,
+			Runtime:   105,
+			Title:     "Uncredited Mock",
+			Genres:    []string{""},
+		}, nil
 	default:
 		return nil, ErrRecordNotFound
 	}
 }
-func (m MockMovieModel) Update(movie *Movie) error {
+
+// GetIncludingDeleted() also returns movie 6, which is in the trash.
+func (m MockMovieModel) GetIncludingDeleted(orgID, id int64) (*Movie, error) {
+	if id == 6 {
+		deletedAt := time.Now().Add(-time.Hour)
+		return &Movie{ID: 6, CreatedAt: time.Now(), Title: "Deleted Mock", Year: 2023, Runtime: 105, Genres: []string{""}, Version: 1, DeletedAt: &deletedAt}, nil
+	}
+	return m.Get(orgID, id)
+}
+
+func (m MockMovieModel) Update(orgID, userID int64, movie *Movie) error {
 	if movie.Title == "Conflict Title" {
 		return ErrEditConflict
 	}
@@ -244,7 +747,7 @@ func (m MockMovieModel) Update(movie *Movie) error {
 	return nil
 }
 
-func (m MockMovieModel) Delete(id int64) error {
+func (m MockMovieModel) Delete(orgID, userID, id int64) error {
 	switch id {
 	case 1:
 		return nil
@@ -255,9 +758,97 @@ func (m MockMovieModel) Delete(id int64) error {
 	}
 }
 
-func (m MockMovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (m MockMovieModel) GetAll(orgID int64, search MovieSearch, filters Filters) ([]*Movie, Metadata, error) {
 	if filters.Sort == "title" {
 		return nil, Metadata{}, errors.New("database fall")
 	}
 	return nil, Metadata{}, nil
 }
+
+func (m MockMovieModel) SetImage(orgID, movieID int64, kind, key string) (*Image, error) {
+	switch movieID {
+	case 1:
+		return &Image{Key: fmt.Sprintf("movies/1/%s-old.png", kind), HasThumbnails: true}, nil
+	case 2:
+		return nil, errors.New("database fall")
+	case 5:
+		return nil, nil
+	default:
+		return nil, ErrRecordNotFound
+	}
+}
+
+func (m MockMovieModel) SetImageThumbnails(orgID, movieID int64, kind, key string) error {
+	return nil
+}
+
+func (m MockMovieModel) GetDeleted(orgID int64, filters Filters) ([]*Movie, Metadata, error) {
+	if filters.Sort == "title" {
+		return nil, Metadata{}, errors.New("database fall")
+	}
+	deletedAt := time.Now().Add(-time.Hour)
+	return []*Movie{
+		{ID: 6, CreatedAt: time.Now(), Title: "Deleted Mock", Year: 2023, Runtime: 105, Genres: []string{""}, Version: 1, DeletedAt: &deletedAt},
+	}, Metadata{}, nil
+}
+
+func (m MockMovieModel) Restore(orgID, userID, id int64) error {
+	switch id {
+	case 1:
+		return nil
+	case 2:
+		return errors.New("database fall")
+	default:
+		return ErrRecordNotFound
+	}
+}
+
+func (m MockMovieModel) PurgeDeleted(before time.Time) ([]*Movie, error) {
+	return []*Movie{
+		{ID: 6, Poster: &Image{Key: "movies/6/poster-purged.png", HasThumbnails: true}},
+	}, nil
+}
+
+func (m MockMovieModel) Import(orgID, userID int64, movies []*Movie) error {
+	for _, movie := range movies {
+		if movie.Title == "fall database" {
+			return errors.New("database fall")
+		}
+	}
+	return nil
+}
+
+func (m MockMovieModel) Export(ctx context.Context, orgID int64, search MovieSearch, fn func(movie *Movie) error) error {
+	if search.Title == "fall database" {
+		return errors.New("database fall")
+	}
+
+	movies := []*Movie{
+		{ID: 1, CreatedAt: time.Now(), Title: "Test Mock", Year: 2023, Runtime: 105, Genres: []string{"drama", "crime"}, Version: 1, AverageRating: 7.5, RatingCount: 2},
+		{ID: 5, CreatedAt: time.Now(), Title: "Uncredited Mock", Year: 2023, Runtime: 105, Genres: []string{"comedy"}, Version: 1},
+	}
+
+	for _, movie := range movies {
+		err := fn(movie)
+		if err != nil {
+			return err
+		}
+		if search.Title == "fall midway" {
+			return errors.New("database fall")
+		}
+	}
+
+	// A slow export takes a quarter of a second or so, for the write timeout tests.
+	if search.Title == "slow" {
+		for i := int64(0); i < 250; i++ {
+			time.Sleep(time.Millisecond)
+
+			err := fn(&Movie{ID: 100 + i, CreatedAt: time.Now(), Title: "Slow Mock", Year: 2023, Runtime: 105, Genres: []string{"drama"}, Version: 1})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,475 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"greenlight.bcc/internal/validator"
+)
+
+// DefaultOrganizationSlug is the organization created by the migrations, which owns every
+// movie added before there were organizations.
+const DefaultOrganizationSlug = "default"
+
+// Roles a user can have in an organization, from least to most privileged.
+const (
+	OrgRoleViewer = "viewer"
+	OrgRoleEditor = "editor"
+	OrgRoleAdmin  = "admin"
+	OrgRoleOwner  = "owner"
+)
+
+var OrgRoles = []string{OrgRoleViewer, OrgRoleEditor, OrgRoleAdmin, OrgRoleOwner}
+
+var (
+	ErrDuplicateSlug = errors.New("duplicate slug")
+
+	SlugRX = regexp.MustCompile("^[a-z0-9]+(?:-[a-z0-9]+)*$")
+)
+
+type Organization struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	Version   int       `json:"-"`
+	// Role is the current user's role in the organization, if they are a member.
+	Role string `json:"role,omitempty"`
+}
+
+// HasRole reports whether the current user's role in the organization is at least role.
+func (o *Organization) HasRole(role string) bool {
+	return o.Role != "" && orgRoleRank(o.Role) >= orgRoleRank(role)
+}
+
+func orgRoleRank(role string) int {
+	for i, r := range OrgRoles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+type Member struct {
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func ValidateOrganization(v *validator.Validator, org *Organization) {
+	v.Check(org.Name != "", "name", "must be provided")
+	v.Check(len(org.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(org.Slug != "", "slug", "must be provided")
+	v.Check(len(org.Slug) <= 63, "slug", "must not be more than 63 bytes long")
+	v.Check(validator.Matches(org.Slug, SlugRX), "slug", "must only contain lowercase letters, digits and single hyphens")
+}
+
+func ValidateOrgRole(v *validator.Validator, role string) {
+	v.Check(role != "", "role", "must be provided")
+	v.Check(validator.PermittedValue(role, OrgRoles...), "role", "must be one of viewer, editor, admin or owner")
+}
+
+// withOrganization runs fn in a transaction scoped to the organization. The row-level
+// security policies on tenant tables only show, and only accept, rows of the organization
+// named by app.current_org_id, so queries run through tx can't reach another
+// organization's data even if they forget to filter on it.
+func withOrganization(ctx context.Context, db *sql.DB, orgID int64, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT set_config('app.current_org_id', $1, true)`, strconv.FormatInt(orgID, 10))
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// withActor is withOrganization for writes which should be attributed to a user. The user
+// is put in app.current_user_id, where triggers recording changes can find it.
+func withActor(ctx context.Context, db *sql.DB, orgID, userID int64, fn func(tx *sql.Tx) error) error {
+	return withOrganization(ctx, db, orgID, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `SELECT set_config('app.current_user_id', $1, true)`, strconv.FormatInt(userID, 10))
+		if err != nil {
+			return err
+		}
+
+		return fn(tx)
+	})
+}
+
+// organizationIDs returns the ids of every organization, for the few queries that have to
+// go through all of them one at a time because of row-level security.
+func organizationIDs(ctx context.Context, db *sql.DB) ([]int64, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id FROM organizations ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgIDs []int64
+	for rows.Next() {
+		var orgID int64
+		err := rows.Scan(&orgID)
+		if err != nil {
+			return nil, err
+		}
+		orgIDs = append(orgIDs, orgID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgIDs, nil
+}
+
+type OrganizationModel struct {
+	DB *sql.DB
+}
+
+// Insert() creates the organization with owner as its first owner.
+func (m OrganizationModel) Insert(org *Organization, ownerID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO organizations (name, slug)
+	VALUES ($1, $2)
+	RETURNING id, created_at, version`
+
+	err = tx.QueryRowContext(ctx, query, org.Name, org.Slug).Scan(&org.ID, &org.CreatedAt, &org.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "organizations_slug_key"`:
+			return ErrDuplicateSlug
+		default:
+			return err
+		}
+	}
+
+	query = `
+	INSERT INTO organization_members (org_id, user_id, role)
+	VALUES ($1, $2, $3)`
+
+	_, err = tx.ExecContext(ctx, query, org.ID, ownerID, OrgRoleOwner)
+	if err != nil {
+		return err
+	}
+
+	org.Role = OrgRoleOwner
+
+	return tx.Commit()
+}
+
+// GetForUser() returns the organization with the user's role in it, which is empty if
+// they aren't a member.
+func (m OrganizationModel) GetForUser(slug string, userID int64) (*Organization, error) {
+	query := `
+	SELECT organizations.id, organizations.created_at, organizations.name, organizations.slug, organizations.version,
+	COALESCE(organization_members.role, '')
+	FROM organizations
+	LEFT JOIN organization_members
+	ON organization_members.org_id = organizations.id AND organization_members.user_id = $2
+	WHERE organizations.slug = $1`
+
+	var org Organization
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, slug, userID).Scan(
+		&org.ID,
+		&org.CreatedAt,
+		&org.Name,
+		&org.Slug,
+		&org.Version,
+		&org.Role,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &org, nil
+}
+
+// GetAllForUser() returns the organizations the user is a member of.
+func (m OrganizationModel) GetAllForUser(userID int64) ([]*Organization, error) {
+	query := `
+	SELECT organizations.id, organizations.created_at, organizations.name, organizations.slug, organizations.version,
+	organization_members.role
+	FROM organizations
+	INNER JOIN organization_members ON organization_members.org_id = organizations.id
+	WHERE organization_members.user_id = $1
+	ORDER BY organizations.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Organization{}
+
+	for rows.Next() {
+		var org Organization
+
+		err := rows.Scan(&org.ID, &org.CreatedAt, &org.Name, &org.Slug, &org.Version, &org.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		orgs = append(orgs, &org)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+func (m OrganizationModel) GetMembers(orgID int64) ([]*Member, error) {
+	query := `
+	SELECT users.id, users.name, users.email, organization_members.role, organization_members.created_at
+	FROM organization_members
+	INNER JOIN users ON users.id = organization_members.user_id
+	WHERE organization_members.org_id = $1
+	AND users.deleted_at IS NULL
+	ORDER BY users.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+
+	for rows.Next() {
+		var member Member
+
+		err := rows.Scan(&member.UserID, &member.Name, &member.Email, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// GetRole() returns the user's role in the organization, or ErrRecordNotFound if they
+// aren't a member.
+func (m OrganizationModel) GetRole(orgID, userID int64) (string, error) {
+	query := `
+	SELECT role
+	FROM organization_members
+	WHERE org_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role string
+	err := m.DB.QueryRowContext(ctx, query, orgID, userID).Scan(&role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return role, nil
+}
+
+// SetMember() adds the user to the organization with the slug, or changes their role if
+// they are already a member.
+func (m OrganizationModel) SetMember(slug string, userID int64, role string) error {
+	query := `
+	INSERT INTO organization_members (org_id, user_id, role)
+	SELECT id, $2, $3 FROM organizations WHERE slug = $1
+	ON CONFLICT (org_id, user_id) DO UPDATE SET role = EXCLUDED.role`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, slug, userID, role)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m OrganizationModel) RemoveMember(orgID, userID int64) error {
+	query := `
+	DELETE FROM organization_members
+	WHERE org_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type MockOrganizationModel struct{}
+
+func (m MockOrganizationModel) Insert(org *Organization, ownerID int64) error {
+	switch org.Slug {
+	case "taken":
+		return ErrDuplicateSlug
+	case "fall":
+		return errors.New("database has fallen")
+	}
+	org.ID = 10
+	org.CreatedAt = time.Now()
+	org.Version = 1
+	org.Role = OrgRoleOwner
+	return nil
+}
+
+// GetForUser() makes user 7 the owner of every organization and everybody else an editor
+// of the default one. The "readonly" and "managed" organizations give them the viewer and
+// admin roles, and they aren't a member of "other". Anonymous users aren't members of
+// anything.
+func (m MockOrganizationModel) GetForUser(slug string, userID int64) (*Organization, error) {
+	org := &Organization{ID: 1, CreatedAt: time.Now(), Name: "Test", Slug: slug, Version: 1}
+
+	switch slug {
+	case "missing":
+		return nil, ErrRecordNotFound
+	case "fall":
+		return nil, errors.New("database has fallen")
+	case DefaultOrganizationSlug:
+		org.Role = OrgRoleEditor
+	case "readonly":
+		org.ID = 2
+		org.Role = OrgRoleViewer
+	case "managed":
+		org.ID = 3
+		org.Role = OrgRoleAdmin
+	case "members-fall":
+		org.ID = 4
+		org.Role = OrgRoleAdmin
+	case "other":
+		org.ID = 5
+	}
+
+	switch {
+	case userID == 0:
+		org.Role = ""
+	case userID == 7:
+		org.Role = OrgRoleOwner
+	}
+
+	return org, nil
+}
+
+func (m MockOrganizationModel) GetAllForUser(userID int64) ([]*Organization, error) {
+	if userID == 2 {
+		return nil, errors.New("database has fallen")
+	}
+	return []*Organization{
+		{ID: 1, CreatedAt: time.Now(), Name: "Default", Slug: DefaultOrganizationSlug, Version: 1, Role: OrgRoleEditor},
+	}, nil
+}
+
+func (m MockOrganizationModel) GetMembers(orgID int64) ([]*Member, error) {
+	if orgID == 4 {
+		return nil, errors.New("database has fallen")
+	}
+	return []*Member{
+		{UserID: 1, Name: "Test", Email: "test@test.com", Role: OrgRoleEditor, CreatedAt: time.Now()},
+	}, nil
+}
+
+// GetRole() makes user 5 an owner and user 8 not a member. Looking up user 9 fails.
+func (m MockOrganizationModel) GetRole(orgID, userID int64) (string, error) {
+	switch userID {
+	case 5:
+		return OrgRoleOwner, nil
+	case 8:
+		return "", ErrRecordNotFound
+	case 9:
+		return "", errors.New("database has fallen")
+	}
+	return OrgRoleViewer, nil
+}
+
+func (m MockOrganizationModel) SetMember(slug string, userID int64, role string) error {
+	if userID == 6 {
+		return errors.New("database has fallen")
+	}
+	return nil
+}
+
+func (m MockOrganizationModel) RemoveMember(orgID, userID int64) error {
+	switch userID {
+	case 6:
+		return errors.New("database has fallen")
+	case 8:
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,440 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"greenlight.bcc/internal/validator"
+)
+
+const (
+	CreditRoleDirector = "director"
+	CreditRoleActor    = "actor"
+	CreditRoleWriter   = "writer"
+)
+
+var (
+	CreditRoles = []string{CreditRoleDirector, CreditRoleActor, CreditRoleWriter}
+
+	ErrDuplicateCredit = errors.New("duplicate credit")
+)
+
+// Person is someone who worked on movies of the organization.
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	BirthYear int32     `json:"birth_year,omitempty"`
+	Bio       string    `json:"bio,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+// Credit is a person's part in a movie. Actors have the character they played, and can
+// have more than one credit on a movie.
+type Credit struct {
+	ID        int64  `json:"id"`
+	MovieID   int64  `json:"movie_id"`
+	PersonID  int64  `json:"person_id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	Character string `json:"character,omitempty"`
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+	if person.BirthYear != 0 {
+		v.Check(person.BirthYear >= 1800, "birth_year", "must be greater than 1800")
+		v.Check(person.BirthYear <= int32(time.Now().Year()), "birth_year", "must not be in the future")
+	}
+	v.Check(len(person.Bio) <= 10_000, "bio", "must not be more than 10000 bytes long")
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", "must be provided")
+	v.Check(validator.PermittedValue(credit.Role, CreditRoles...), "role", "must be one of director, actor or writer")
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+	if credit.Role != CreditRoleActor {
+		v.Check(credit.Character == "", "character", "must only be given for actors")
+	}
+}
+
+type PersonModel struct {
+	DB *sql.DB
+}
+
+func (m PersonModel) Insert(orgID int64, person *Person) error {
+	query := `
+	INSERT INTO people (org_id, name, birth_year, bio)
+	VALUES ($1, $2, NULLIF($3, 0), $4)
+	RETURNING id, created_at, version`
+
+	args := []any{orgID, person.Name, person.BirthYear, person.Bio}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, args...).Scan(&person.ID, &person.CreatedAt, &person.Version)
+	})
+}
+
+func (m PersonModel) Get(orgID, id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, name, COALESCE(birth_year, 0), bio, version
+	FROM people
+	WHERE id = $1`
+
+	var person Person
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, id).Scan(
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.BirthYear,
+			&person.Bio,
+			&person.Version,
+		)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &person, nil
+}
+
+func (m PersonModel) Update(orgID int64, person *Person) error {
+	query := `
+	UPDATE people
+	SET name = $1, birth_year = NULLIF($2, 0), bio = $3, version = version + 1
+	WHERE id = $4 AND version = $5
+	RETURNING version`
+
+	args := []any{person.Name, person.BirthYear, person.Bio, person.ID, person.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, args...).Scan(&person.Version)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete() deletes the person along with all their credits.
+func (m PersonModel) Delete(orgID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM people
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rowsAffected int64
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m PersonModel) GetAll(orgID int64, name string, filters Filters) ([]*Person, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, name, COALESCE(birth_year, 0), bio, version
+	FROM people
+	WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	people := []*Person{}
+	totalRecords := 0
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var person Person
+
+			err := rows.Scan(
+				&totalRecords,
+				&person.ID,
+				&person.CreatedAt,
+				&person.Name,
+				&person.BirthYear,
+				&person.Bio,
+				&person.Version,
+			)
+			if err != nil {
+				return err
+			}
+
+			people = append(people, &person)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return people, metadata, nil
+}
+
+type CreditModel struct {
+	DB *sql.DB
+}
+
+// Insert() credits the person on the movie. ErrRecordNotFound is returned if either of
+// them isn't in the organization.
+func (m CreditModel) Insert(orgID int64, credit *Credit) error {
+	query := `
+	WITH credit AS (
+		INSERT INTO credits (org_id, movie_id, person_id, role, character)
+		SELECT movies.org_id, movies.id, people.id, $3, $4
+		FROM movies, people
+		WHERE movies.id = $1 AND movies.deleted_at IS NULL AND people.id = $2
+		RETURNING id, person_id
+	)
+	SELECT credit.id, people.name
+	FROM credit
+	INNER JOIN people ON people.id = credit.person_id`
+
+	args := []any{credit.MovieID, credit.PersonID, credit.Role, credit.Character}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, args...).Scan(&credit.ID, &credit.Name)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		case err.Error() == `pq: duplicate key value violates unique constraint "credits_movie_id_person_id_role_character_key"`:
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetForMovie() returns the movie's credits, directors first, then writers and actors.
+func (m CreditModel) GetForMovie(orgID, movieID int64) ([]*Credit, error) {
+	query := `
+	SELECT credits.id, credits.movie_id, credits.person_id, people.name, credits.role, credits.character
+	FROM credits
+	INNER JOIN people ON people.id = credits.person_id
+	WHERE credits.movie_id = $1
+	ORDER BY array_position(ARRAY['director', 'writer', 'actor'], credits.role), credits.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	credits := []*Credit{}
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, movieID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var credit Credit
+
+			err := rows.Scan(
+				&credit.ID,
+				&credit.MovieID,
+				&credit.PersonID,
+				&credit.Name,
+				&credit.Role,
+				&credit.Character,
+			)
+			if err != nil {
+				return err
+			}
+
+			credits = append(credits, &credit)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+func (m CreditModel) Delete(orgID, movieID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM credits
+	WHERE id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rowsAffected int64
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id, movieID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type MockPersonModel struct{}
+
+func (m MockPersonModel) Insert(orgID int64, person *Person) error {
+	if person.Name == "fall" {
+		return errors.New("database falls")
+	}
+	person.ID = 1
+	person.CreatedAt = time.Now()
+	person.Version = 1
+	return nil
+}
+
+func (m MockPersonModel) Get(orgID, id int64) (*Person, error) {
+	switch id {
+	case 1:
+		return &Person{ID: 1, CreatedAt: time.Now(), Name: "Test Person", BirthYear: 1970, Version: 1}, nil
+	case 2:
+		return nil, errors.New("database falls")
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m MockPersonModel) Update(orgID int64, person *Person) error {
+	switch person.Name {
+	case "Conflict":
+		return ErrEditConflict
+	case "fall":
+		return errors.New("database falls")
+	}
+	person.Version++
+	return nil
+}
+
+func (m MockPersonModel) Delete(orgID, id int64) error {
+	switch id {
+	case 1:
+		return nil
+	case 2:
+		return errors.New("database falls")
+	}
+	return ErrRecordNotFound
+}
+
+func (m MockPersonModel) GetAll(orgID int64, name string, filters Filters) ([]*Person, Metadata, error) {
+	if filters.Sort == "name" {
+		return nil, Metadata{}, errors.New("database falls")
+	}
+	return []*Person{}, Metadata{}, nil
+}
+
+type MockCreditModel struct{}
+
+func (m MockCreditModel) Insert(orgID int64, credit *Credit) error {
+	if credit.Character == "Duplicate" {
+		return ErrDuplicateCredit
+	}
+	switch {
+	case credit.MovieID == 2:
+		return errors.New("database falls")
+	case credit.MovieID != 1 || credit.PersonID != 1:
+		return ErrRecordNotFound
+	}
+	credit.ID = 1
+	credit.Name = "Test Person"
+	return nil
+}
+
+func (m MockCreditModel) GetForMovie(orgID, movieID int64) ([]*Credit, error) {
+	if movieID == 5 {
+		return nil, errors.New("database falls")
+	}
+	return []*Credit{
+		{ID: 1, MovieID: movieID, PersonID: 1, Name: "Test Person", Role: CreditRoleDirector},
+	}, nil
+}
+
+func (m MockCreditModel) Delete(orgID, movieID, id int64) error {
+	switch id {
+	case 1:
+		return nil
+	case 2:
+		return errors.New("database falls")
+	}
+	return ErrRecordNotFound
+}
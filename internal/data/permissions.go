@@ -20,17 +20,35 @@ func (p Permissions) Include(code string) bool {
 	return false
 }
 
+// Intersect returns the codes present in both p and other.
+func (p Permissions) Intersect(other Permissions) Permissions {
+	permissions := Permissions{}
+	for i := range p {
+		if other.Include(p[i]) {
+			permissions = append(permissions, p[i])
+		}
+	}
+	return permissions
+}
+
 type PermissionModel struct {
 	DB *sql.DB
 }
 
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	// A user's permissions are those granted to them directly together with those of
+	// every role they hold.
 	query := `
 	SELECT permissions.code
 	FROM permissions
 	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-	INNER JOIN users ON users_permissions.user_id = users.id
-	WHERE users.id = $1`
+	WHERE users_permissions.user_id = $1
+	UNION
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+	INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+	WHERE users_roles.user_id = $1`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -57,28 +75,186 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	return permissions, nil
 }
 
-func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+func (m PermissionModel) AddForUser(userID int64, audit *AuditEntry, codes ...string) error {
 	query := `
 	INSERT INTO users_permissions
-	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	ON CONFLICT DO NOTHING`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
-	return err
+	return withAudit(ctx, m.DB, audit, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query, userID, pq.Array(codes))
+		return err
+	})
+}
+
+// GetAll() returns every permission code that exists.
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+	SELECT code
+	FROM permissions
+	ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// RemoveForUser() revokes permissions granted to the user directly. Permissions the user
+// holds through a role are unaffected.
+func (m PermissionModel) RemoveForUser(userID int64, audit *AuditEntry, codes ...string) error {
+	query := `
+	DELETE FROM users_permissions
+	USING permissions
+	WHERE users_permissions.permission_id = permissions.id
+	AND users_permissions.user_id = $1
+	AND permissions.code = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return withAudit(ctx, m.DB, audit, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query, userID, pq.Array(codes))
+		return err
+	})
+}
+
+func (m PermissionModel) GetRolesForUser(userID int64) ([]string, error) {
+	query := `
+	SELECT roles.name
+	FROM roles
+	INNER JOIN users_roles ON users_roles.role_id = roles.id
+	WHERE users_roles.user_id = $1
+	ORDER BY roles.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// AddRolesForUser() assigns the named roles to the user. It returns ErrRecordNotFound if
+// any of the roles doesn't exist, so that a misconfigured role isn't silently ignored.
+func (m PermissionModel) AddRolesForUser(userID int64, roles ...string) error {
+	query := `
+	INSERT INTO users_roles
+	SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM roles WHERE name = ANY($1)`, pq.Array(roles)).Scan(&found)
+	if err != nil {
+		return err
+	}
+
+	if found != len(roles) {
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, query, userID, pq.Array(roles))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 type MockPermissionModel struct{}
 
 func (m MockPermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	switch userID {
+	case 1:
+		return Permissions{"movies:read"}, nil
+	case 2:
+		return nil, errors.New("something went wrong")
+	case 7:
+		return Permissions{"movies:read", "movies:write", "reviews:moderate", "users:admin"}, nil
+	}
 	return nil, nil
 }
 
-func (m MockPermissionModel) AddForUser(userID int64, codes ...string) error {
+func (m MockPermissionModel) GetAll() (Permissions, error) {
+	return Permissions{"movies:read", "movies:write", "reviews:moderate", "users:admin"}, nil
+}
+
+func (m MockPermissionModel) RemoveForUser(userID int64, audit *AuditEntry, codes ...string) error {
+	if userID == 1 {
+		return errors.New("something went wrong")
+	}
+	return mockAudit(audit)
+}
+
+func (m MockPermissionModel) GetRolesForUser(userID int64) ([]string, error) {
+	switch userID {
+	case 2:
+		return nil, errors.New("something went wrong")
+	case 7:
+		return []string{"admin"}, nil
+	}
+	return []string{"viewer"}, nil
+}
+
+func (m MockPermissionModel) AddForUser(userID int64, audit *AuditEntry, codes ...string) error {
 	if userID == 1 {
 		return errors.New("something went wrong")
 		//I love java, don't blame me for this
 	}
+	return mockAudit(audit)
+}
+
+func (m MockPermissionModel) AddRolesForUser(userID int64, roles ...string) error {
+	if userID == 1 {
+		return errors.New("something went wrong")
+	}
 	return nil
 }
@@ -0,0 +1,178 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"greenlight.bcc/internal/validator"
+)
+
+// Rating is a user's score for a movie, from 1 to 10. Each user has at most one rating
+// per movie, and the movie's average_rating and rating_count are kept up to date from
+// them by a trigger.
+type Rating struct {
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"-"`
+	Rating    int       `json:"rating"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ValidateRating(v *validator.Validator, rating *Rating) {
+	v.Check(rating.Rating >= 1, "rating", "must be at least 1")
+	v.Check(rating.Rating <= 10, "rating", "must not be more than 10")
+}
+
+type RatingModel struct {
+	DB *sql.DB
+}
+
+// Set() adds the user's rating of the movie, or replaces the one they already have. The
+// movie is selected under the organization's row-level security, so ErrRecordNotFound is
+// returned for movies in other organizations, which the foreign key alone would allow.
+func (m RatingModel) Set(orgID int64, rating *Rating) error {
+	query := `
+	INSERT INTO ratings (movie_id, user_id, org_id, rating)
+	SELECT id, $2, org_id, $3
+	FROM movies
+	WHERE id = $1 AND deleted_at IS NULL
+	ON CONFLICT (movie_id, user_id) DO UPDATE
+	SET rating = EXCLUDED.rating, updated_at = NOW()
+	RETURNING created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, rating.MovieID, rating.UserID, rating.Rating).Scan(&rating.CreatedAt, &rating.UpdatedAt)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m RatingModel) Delete(orgID, movieID, userID int64) error {
+	query := `
+	DELETE FROM ratings
+	WHERE movie_id = $1 AND user_id = $2 AND org_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rowsAffected int64
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, movieID, userID, orgID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForUser() returns the user's ratings in every organization, for their data export.
+// Row-level security only lets us see one organization's ratings at a time, so it goes
+// through them one by one.
+func (m RatingModel) GetAllForUser(userID int64) ([]*Rating, error) {
+	query := `
+	SELECT movie_id, user_id, rating, created_at, updated_at
+	FROM ratings
+	WHERE user_id = $1
+	ORDER BY created_at, movie_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	orgIDs, err := organizationIDs(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	ratings := []*Rating{}
+
+	for _, orgID := range orgIDs {
+		err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+			rows, err := tx.QueryContext(ctx, query, userID)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var rating Rating
+
+				err := rows.Scan(
+					&rating.MovieID,
+					&rating.UserID,
+					&rating.Rating,
+					&rating.CreatedAt,
+					&rating.UpdatedAt,
+				)
+				if err != nil {
+					return err
+				}
+
+				ratings = append(ratings, &rating)
+			}
+
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ratings, nil
+}
+
+type MockRatingModel struct{}
+
+func (m MockRatingModel) Set(orgID int64, rating *Rating) error {
+	switch rating.MovieID {
+	case 1:
+		rating.CreatedAt = time.Now()
+		rating.UpdatedAt = rating.CreatedAt
+		return nil
+	case 2:
+		return errors.New("database falls")
+	default:
+		return ErrRecordNotFound
+	}
+}
+
+func (m MockRatingModel) Delete(orgID, movieID, userID int64) error {
+	switch movieID {
+	case 1:
+		return nil
+	case 2:
+		return errors.New("database falls")
+	default:
+		return ErrRecordNotFound
+	}
+}
+
+func (m MockRatingModel) GetAllForUser(userID int64) ([]*Rating, error) {
+	if userID == 2 {
+		return nil, errors.New("database falls")
+	}
+	return []*Rating{}, nil
+}
@@ -0,0 +1,567 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"greenlight.bcc/internal/validator"
+)
+
+var (
+	ErrDuplicateReview = errors.New("duplicate review")
+)
+
+// Review is a user's written review of a movie. Each user can review a movie once. Hidden
+// reviews have been taken down by a moderator, and are only shown to moderators and
+// their author.
+type Review struct {
+	ID        int64     `json:"id"`
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+	Hidden    bool      `json:"hidden"`
+	Version   int32     `json:"version"`
+}
+
+// ReviewReport is a report of an abusive review, waiting for a moderator.
+type ReviewReport struct {
+	ID        int64     `json:"id"`
+	ReviewID  int64     `json:"review_id"`
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Body != "", "body", "must be provided")
+	v.Check(len(review.Body) <= 10_000, "body", "must not be more than 10000 bytes long")
+}
+
+func ValidateReviewReport(v *validator.Validator, report *ReviewReport) {
+	v.Check(report.Reason != "", "reason", "must be provided")
+	v.Check(len(report.Reason) <= 1000, "reason", "must not be more than 1000 bytes long")
+}
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+// Insert() adds the review to the movie, if it is in the organization. The movie is
+// selected under the organization's row-level security, as for ratings.
+func (m ReviewModel) Insert(orgID int64, review *Review) error {
+	query := `
+	WITH review AS (
+		INSERT INTO reviews (movie_id, user_id, org_id, body)
+		SELECT id, $2, org_id, $3
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, user_id, created_at, updated_at, version
+	)
+	SELECT review.id, users.name, review.created_at, review.updated_at, review.version
+	FROM review
+	INNER JOIN users ON users.id = review.user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, review.MovieID, review.UserID, review.Body).Scan(
+			&review.ID,
+			&review.Author,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Version,
+		)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_movie_id_user_id_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ReviewModel) Get(orgID, movieID, id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT reviews.id, reviews.movie_id, reviews.user_id, users.name, reviews.created_at, reviews.updated_at,
+		reviews.body, reviews.hidden, reviews.version
+	FROM reviews
+	INNER JOIN users ON users.id = reviews.user_id
+	WHERE reviews.id = $1 AND reviews.movie_id = $2 AND reviews.org_id = $3`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, id, movieID, orgID).Scan(
+			&review.ID,
+			&review.MovieID,
+			&review.UserID,
+			&review.Author,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Body,
+			&review.Hidden,
+			&review.Version,
+		)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+// GetAllForMovie() returns a page of the movie's reviews, leaving out hidden ones unless
+// includeHidden is set.
+func (m ReviewModel) GetAllForMovie(orgID, movieID int64, includeHidden bool, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), reviews.id, reviews.movie_id, reviews.user_id, users.name, reviews.created_at,
+		reviews.updated_at, reviews.body, reviews.hidden, reviews.version
+	FROM reviews
+	INNER JOIN users ON users.id = reviews.user_id
+	WHERE reviews.movie_id = $1 AND reviews.org_id = $2
+	AND (NOT reviews.hidden OR $3)
+	ORDER BY reviews.%s %s, reviews.id ASC
+	LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{movieID, orgID, includeHidden, filters.limit(), filters.offset()}
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var review Review
+
+			err := rows.Scan(
+				&totalRecords,
+				&review.ID,
+				&review.MovieID,
+				&review.UserID,
+				&review.Author,
+				&review.CreatedAt,
+				&review.UpdatedAt,
+				&review.Body,
+				&review.Hidden,
+				&review.Version,
+			)
+			if err != nil {
+				return err
+			}
+
+			reviews = append(reviews, &review)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+// GetAllForUser() returns everything the user has written, in every organization, for
+// their data export. Like RatingModel.GetAllForUser() it goes through the organizations
+// one by one.
+func (m ReviewModel) GetAllForUser(userID int64) ([]*Review, error) {
+	query := `
+	SELECT reviews.id, reviews.movie_id, reviews.user_id, users.name, reviews.created_at, reviews.updated_at,
+		reviews.body, reviews.hidden, reviews.version
+	FROM reviews
+	INNER JOIN users ON users.id = reviews.user_id
+	WHERE reviews.user_id = $1
+	ORDER BY reviews.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	orgIDs, err := organizationIDs(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews := []*Review{}
+
+	for _, orgID := range orgIDs {
+		err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+			rows, err := tx.QueryContext(ctx, query, userID)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var review Review
+
+				err := rows.Scan(
+					&review.ID,
+					&review.MovieID,
+					&review.UserID,
+					&review.Author,
+					&review.CreatedAt,
+					&review.UpdatedAt,
+					&review.Body,
+					&review.Hidden,
+					&review.Version,
+				)
+				if err != nil {
+					return err
+				}
+
+				reviews = append(reviews, &review)
+			}
+
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reviews, nil
+}
+
+// Update() saves the review's body, as long as nobody else has changed it since it was
+// read, in the same way as MovieModel.Update(). Whether it is hidden is left to
+// SetHidden(), so that an edit can't undo a moderator's decision.
+func (m ReviewModel) Update(orgID int64, review *Review) error {
+	query := `
+	UPDATE reviews
+	SET body = $1, updated_at = NOW(), version = version + 1
+	WHERE id = $2 AND version = $3
+	RETURNING updated_at, version`
+
+	args := []any{review.Body, review.ID, review.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.Version)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetHidden() hides or shows the review. Moderation isn't an edit, so the version and
+// the author's fields are left alone and an edit the author is making doesn't conflict
+// with it.
+func (m ReviewModel) SetHidden(orgID, id int64, hidden bool) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	UPDATE reviews
+	SET hidden = $1
+	WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rowsAffected int64
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, hidden, id)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m ReviewModel) Delete(orgID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM reviews
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rowsAffected int64
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Report() queues the review for moderation. A user reporting the same review again
+// replaces their earlier report, and puts it back in the queue if it was resolved.
+func (m ReviewModel) Report(report *ReviewReport) error {
+	query := `
+	INSERT INTO review_reports (review_id, user_id, reason)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (review_id, user_id) DO UPDATE
+	SET reason = EXCLUDED.reason, created_at = NOW(), resolved_at = NULL
+	RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, report.ReviewID, report.UserID, report.Reason).Scan(&report.ID, &report.CreatedAt)
+}
+
+// GetReports() returns a page of the organization's moderation queue.
+func (m ReviewModel) GetReports(orgID int64, filters Filters) ([]*ReviewReport, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), review_reports.id, review_reports.review_id, reviews.movie_id,
+		review_reports.user_id, review_reports.reason, review_reports.created_at
+	FROM review_reports
+	INNER JOIN reviews ON reviews.id = review_reports.review_id
+	WHERE reviews.org_id = $1 AND review_reports.resolved_at IS NULL
+	ORDER BY review_reports.%s %s, review_reports.id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	totalRecords := 0
+	reports := []*ReviewReport{}
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, orgID, filters.limit(), filters.offset())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var report ReviewReport
+
+			err := rows.Scan(
+				&totalRecords,
+				&report.ID,
+				&report.ReviewID,
+				&report.MovieID,
+				&report.UserID,
+				&report.Reason,
+				&report.CreatedAt,
+			)
+			if err != nil {
+				return err
+			}
+
+			reports = append(reports, &report)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reports, metadata, nil
+}
+
+// ResolveReports() takes the review's reports out of the moderation queue.
+func (m ReviewModel) ResolveReports(reviewID int64) error {
+	query := `
+	UPDATE review_reports
+	SET resolved_at = NOW()
+	WHERE review_id = $1 AND resolved_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, reviewID)
+	return err
+}
+
+type MockReviewModel struct{}
+
+func (m MockReviewModel) Insert(orgID int64, review *Review) error {
+	if review.Body == "Duplicate review" {
+		return ErrDuplicateReview
+	}
+	switch review.MovieID {
+	case 1:
+		review.ID = 1
+		review.Author = "Test"
+		review.CreatedAt = time.Now()
+		review.UpdatedAt = review.CreatedAt
+		review.Version = 1
+		return nil
+	case 2:
+		return errors.New("database falls")
+	default:
+		return ErrRecordNotFound
+	}
+}
+
+// Get() returns a review by user 1 for id 1, and one by them that is too old to edit for
+// id 4. Reviews 5 to 7 are by user 5: 5 can't be updated without a conflict, 6 is hidden
+// and can't have its reports resolved, and 7 can be neither updated nor deleted. They are
+// all in organization 1, and as with row-level security other organizations can't see them.
+func (m MockReviewModel) Get(orgID, movieID, id int64) (*Review, error) {
+	if orgID != 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	review := &Review{
+		ID:        id,
+		MovieID:   movieID,
+		UserID:    5,
+		Author:    "Test",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Body:      "Test review",
+		Version:   1,
+	}
+
+	switch id {
+	case 1:
+		review.UserID = 1
+	case 2:
+		return nil, errors.New("database falls")
+	case 4:
+		review.UserID = 1
+		review.CreatedAt = time.Now().Add(-30 * 24 * time.Hour)
+	case 5:
+		review.Body = "Conflict"
+	case 6:
+		review.Hidden = true
+	case 7:
+		review.Body = "fall"
+	default:
+		return nil, ErrRecordNotFound
+	}
+
+	return review, nil
+}
+
+func (m MockReviewModel) GetAllForMovie(orgID, movieID int64, includeHidden bool, filters Filters) ([]*Review, Metadata, error) {
+	if filters.Sort == "created_at" {
+		return nil, Metadata{}, errors.New("database falls")
+	}
+	return []*Review{}, Metadata{}, nil
+}
+
+func (m MockReviewModel) GetAllForUser(userID int64) ([]*Review, error) {
+	return []*Review{}, nil
+}
+
+func (m MockReviewModel) Update(orgID int64, review *Review) error {
+	switch review.Body {
+	case "Conflict":
+		return ErrEditConflict
+	case "fall":
+		return errors.New("database falls")
+	}
+	review.Version++
+	return nil
+}
+
+func (m MockReviewModel) SetHidden(orgID, id int64, hidden bool) error {
+	switch id {
+	case 5:
+		return ErrRecordNotFound
+	case 7:
+		return errors.New("database falls")
+	}
+	return nil
+}
+
+func (m MockReviewModel) Delete(orgID, id int64) error {
+	if id == 7 {
+		return errors.New("database falls")
+	}
+	return nil
+}
+
+func (m MockReviewModel) Report(report *ReviewReport) error {
+	if report.Reason == "fall" {
+		return errors.New("database falls")
+	}
+	report.ID = 1
+	report.CreatedAt = time.Now()
+	return nil
+}
+
+func (m MockReviewModel) GetReports(orgID int64, filters Filters) ([]*ReviewReport, Metadata, error) {
+	if filters.Sort == "created_at" {
+		return nil, Metadata{}, errors.New("database falls")
+	}
+	return []*ReviewReport{}, Metadata{}, nil
+}
+
+func (m MockReviewModel) ResolveReports(reviewID int64) error {
+	if reviewID == 6 {
+		return errors.New("database falls")
+	}
+	return nil
+}
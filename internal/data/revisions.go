@@ -0,0 +1,193 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	RevisionBaseline = "baseline"
+	RevisionInsert   = "insert"
+	RevisionUpdate   = "update"
+	RevisionDelete   = "delete"
+	RevisionRestore  = "restore"
+)
+
+// MovieRevision is a recorded change to a movie. Version is the movie's version after the
+// change; deleting and restoring don't bump it, so their revisions share the version of
+// the edit before them. Movies which existed before revisions were recorded start with a
+// baseline revision of how they were then, in place of an insert. UserID is 0 when the
+// change wasn't made through the API, or the user has since been deleted.
+type MovieRevision struct {
+	ID        int64                  `json:"id"`
+	MovieID   int64                  `json:"movie_id"`
+	Version   int32                  `json:"version"`
+	Action    string                 `json:"action"`
+	UserID    int64                  `json:"user_id,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	Changes   map[string]FieldChange `json:"changes"`
+}
+
+// FieldChange is a field's value before and after a revision, as JSON. Old is null for
+// the fields of a newly created movie.
+type FieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// MovieRevisionModel reads the revisions which the movies_record_revision trigger keeps.
+// Nothing writes to them directly.
+type MovieRevisionModel struct {
+	DB *sql.DB
+}
+
+// GetAllForMovie() returns the movie's revisions, newest first unless filters says
+// otherwise. The history of a movie in the trash can still be read.
+func (m MovieRevisionModel) GetAllForMovie(orgID, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, movie_id, version, action, COALESCE(user_id, 0), created_at, changes
+	FROM movie_revisions
+	WHERE movie_id = $1
+	ORDER BY %s %s, id %[2]s
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	revisions := []*MovieRevision{}
+	totalRecords := 0
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var revision MovieRevision
+			var changes []byte
+
+			err := rows.Scan(
+				&totalRecords,
+				&revision.ID,
+				&revision.MovieID,
+				&revision.Version,
+				&revision.Action,
+				&revision.UserID,
+				&revision.CreatedAt,
+				&changes,
+			)
+			if err != nil {
+				return err
+			}
+
+			err = json.Unmarshal(changes, &revision.Changes)
+			if err != nil {
+				return err
+			}
+
+			revisions = append(revisions, &revision)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+// GetVersion() returns the movie's fields as they were at the given version, from the
+// snapshot of the edit which created it. Only the fields which revisions track are set.
+func (m MovieRevisionModel) GetVersion(orgID, movieID int64, version int32) (*Movie, error) {
+	if movieID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT snapshot
+	FROM movie_revisions
+	WHERE movie_id = $1 AND version = $2 AND action IN ('baseline', 'insert', 'update')
+	ORDER BY id DESC
+	LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var snapshot []byte
+
+	err := withOrganization(ctx, m.DB, orgID, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, movieID, version).Scan(&snapshot)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	// The snapshot holds the runtime as a plain number of minutes, not in the "N mins"
+	// form that Runtime reads.
+	var fields struct {
+		Title   string   `json:"title"`
+		Year    int32    `json:"year"`
+		Runtime int32    `json:"runtime"`
+		Genres  []string `json:"genres"`
+	}
+
+	err = json.Unmarshal(snapshot, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Movie{
+		ID:      movieID,
+		Title:   fields.Title,
+		Year:    fields.Year,
+		Runtime: Runtime(fields.Runtime),
+		Genres:  fields.Genres,
+		Version: version,
+	}, nil
+}
+
+type MockMovieRevisionModel struct{}
+
+func (m MockMovieRevisionModel) GetAllForMovie(orgID, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	if filters.Sort == "version" {
+		return nil, Metadata{}, errors.New("database fall")
+	}
+	return []*MovieRevision{
+		{
+			ID:        2,
+			MovieID:   movieID,
+			Version:   2,
+			Action:    RevisionUpdate,
+			UserID:    1,
+			CreatedAt: time.Now(),
+			Changes:   map[string]FieldChange{"title": {Old: json.RawMessage(`"Old Mock"`), New: json.RawMessage(`"Test Mock"`)}},
+		},
+	}, Metadata{}, nil
+}
+
+func (m MockMovieRevisionModel) GetVersion(orgID, movieID int64, version int32) (*Movie, error) {
+	switch {
+	case movieID == 2:
+		return nil, errors.New("database fall")
+	case version == 1:
+		return &Movie{ID: movieID, Version: 1, Title: "Old Mock", Year: 2022, Runtime: 100, Genres: []string{"drama"}}, nil
+	case version == 3:
+		return &Movie{ID: movieID, Version: 3, Title: "Conflict Title", Year: 2022, Runtime: 100, Genres: []string{"drama"}}, nil
+	default:
+		return nil, ErrRecordNotFound
+	}
+}
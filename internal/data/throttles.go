@@ -0,0 +1,192 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// LoginThrottle tracks failed logins for an email address. Throttles are keyed by the
+// address that was tried rather than by user, so addresses without an account are locked
+// out in exactly the same way and the responses don't reveal which ones exist.
+type LoginThrottle struct {
+	Email          string
+	FailedAttempts int
+	WindowStart    time.Time
+	LockedUntil    *time.Time
+	Lockouts       int
+}
+
+type LockoutPolicy struct {
+	MaxAttempts int
+	Window      time.Duration
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+func (t *LoginThrottle) Locked(now time.Time) bool {
+	return t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
+
+func (t *LoginThrottle) RetryAfter(now time.Time) time.Duration {
+	if !t.Locked(now) {
+		return 0
+	}
+	return t.LockedUntil.Sub(now)
+}
+
+// fail records a failed attempt at now and reports whether it locked the address. Each
+// successive lockout lasts twice as long as the one before, up to policy.MaxDuration.
+func (t *LoginThrottle) fail(now time.Time, policy LockoutPolicy) bool {
+	if now.Sub(t.WindowStart) > policy.Window {
+		t.WindowStart = now
+		t.FailedAttempts = 0
+	}
+
+	t.FailedAttempts++
+	if t.FailedAttempts < policy.MaxAttempts {
+		return false
+	}
+
+	duration := policy.Duration
+	for i := 0; i < t.Lockouts && duration < policy.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > policy.MaxDuration {
+		duration = policy.MaxDuration
+	}
+
+	lockedUntil := now.Add(duration)
+	t.LockedUntil = &lockedUntil
+	t.Lockouts++
+	t.FailedAttempts = 0
+	t.WindowStart = now
+
+	return true
+}
+
+type LoginThrottleModel struct {
+	DB *sql.DB
+}
+
+// Get() returns the throttle for email. An address with no failed attempts gets an empty
+// throttle rather than ErrRecordNotFound.
+func (m LoginThrottleModel) Get(email string) (*LoginThrottle, error) {
+	query := `
+	SELECT email, failed_attempts, window_start, locked_until, lockouts
+	FROM login_throttles
+	WHERE email = $1`
+
+	throttle := LoginThrottle{Email: email}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&throttle.Email,
+		&throttle.FailedAttempts,
+		&throttle.WindowStart,
+		&throttle.LockedUntil,
+		&throttle.Lockouts,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return &throttle, nil
+}
+
+// RecordFailure() counts a failed login for email, locking it once policy.MaxAttempts is
+// reached within policy.Window. The boolean result reports whether this failure was the
+// one that locked it.
+func (m LoginThrottleModel) RecordFailure(email string, policy LockoutPolicy) (*LoginThrottle, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO login_throttles (email) VALUES ($1) ON CONFLICT DO NOTHING`, email)
+	if err != nil {
+		return nil, false, err
+	}
+
+	query := `
+	SELECT email, failed_attempts, window_start, locked_until, lockouts
+	FROM login_throttles
+	WHERE email = $1
+	FOR UPDATE`
+
+	var throttle LoginThrottle
+	err = tx.QueryRowContext(ctx, query, email).Scan(
+		&throttle.Email,
+		&throttle.FailedAttempts,
+		&throttle.WindowStart,
+		&throttle.LockedUntil,
+		&throttle.Lockouts,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	locked := throttle.fail(time.Now(), policy)
+
+	query = `
+	UPDATE login_throttles
+	SET failed_attempts = $2, window_start = $3, locked_until = $4, lockouts = $5
+	WHERE email = $1`
+	args := []any{throttle.Email, throttle.FailedAttempts, throttle.WindowStart, throttle.LockedUntil, throttle.Lockouts}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &throttle, locked, tx.Commit()
+}
+
+// Reset() forgets all failed attempts for email, unlocking it.
+func (m LoginThrottleModel) Reset(email string, audit *AuditEntry) error {
+	query := `
+	DELETE FROM login_throttles
+	WHERE email = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return withAudit(ctx, m.DB, audit, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query, email)
+		return err
+	})
+}
+
+type MockLoginThrottleModel struct{}
+
+func (m MockLoginThrottleModel) Get(email string) (*LoginThrottle, error) {
+	switch {
+	case strings.HasPrefix(email, "locked"):
+		lockedUntil := time.Now().Add(5 * time.Minute)
+		return &LoginThrottle{Email: email, LockedUntil: &lockedUntil, Lockouts: 1}, nil
+	case strings.HasPrefix(email, "throttlefall"):
+		return nil, errors.New("error occurred")
+	}
+	return &LoginThrottle{Email: email}, nil
+}
+
+func (m MockLoginThrottleModel) RecordFailure(email string, policy LockoutPolicy) (*LoginThrottle, bool, error) {
+	throttle := &LoginThrottle{Email: email, WindowStart: time.Now()}
+	if strings.HasPrefix(email, "locking") {
+		throttle.FailedAttempts = policy.MaxAttempts - 1
+	}
+	locked := throttle.fail(time.Now(), policy)
+	return throttle, locked, nil
+}
+
+func (m MockLoginThrottleModel) Reset(email string, audit *AuditEntry) error {
+	if email == "testErr@test.com" {
+		return errors.New("error occurred")
+	}
+	return mockAudit(audit)
+}
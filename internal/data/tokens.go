@@ -9,19 +9,33 @@ import (
 	"errors"
 	"greenlight.bcc/internal/validator" // New import
 	"time"
+
+	"github.com/lib/pq"
 )
 
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+	ScopeMFA            = "mfa"
+	ScopeEmailChange    = "email-change"
+	ScopeMagicLink      = "magic-link"
 )
 
 type Token struct {
-	Plaintext string    `json:"token"`
-	Hash      []byte    `json:"-"`
-	UserID    int64     `json:"-"`
-	Expiry    time.Time `json:"expiry"`
-	Scope     string    `json:"-"`
+	Plaintext  string     `json:"token"`
+	Hash       []byte     `json:"-"`
+	UserID     int64      `json:"-"`
+	Expiry     time.Time  `json:"expiry"`
+	Scope      string     `json:"-"`
+	ID         int64      `json:"-"`
+	CreatedAt  time.Time  `json:"-"`
+	LastUsedAt *time.Time `json:"-"`
+	UserAgent  string     `json:"-"`
+	IP         string     `json:"-"`
+	RotatedAt  *time.Time `json:"-"`
+	SessionID  int64      `json:"-"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -63,16 +77,31 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewSession() works like New() but also records the client the token was issued to.
+// sessionID is the ID of the refresh token an authentication token is issued with, and 0
+// for the refresh token itself.
+func (m TokenModel) NewSession(userID int64, ttl time.Duration, scope, userAgent, ip string, sessionID int64) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	token.UserAgent = userAgent
+	token.IP = ip
+	token.SessionID = sessionID
+	err = m.Insert(token)
+	return token, err
+}
+
 // Insert() adds the data for a specific token to the tokens table.
 func (m TokenModel) Insert(token *Token) error {
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)`
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	INSERT INTO tokens (hash, user_id, expiry, scope, user_agent, ip, session_id)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0))
+	RETURNING id, created_at`
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.UserAgent, token.IP, token.SessionID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&token.ID, &token.CreatedAt)
 }
 
 func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
@@ -85,6 +114,245 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	return err
 }
 
+// RevokeAllForUser() signs the user out everywhere, deleting their authentication, refresh
+// and mfa tokens together with their API keys.
+func (m TokenModel) RevokeAllForUser(userID int64, audit *AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return withAudit(ctx, m.DB, audit, func(tx *sql.Tx) error {
+		return revokeUserCredentials(ctx, tx, userID)
+	})
+}
+
+// revokeUserCredentials deletes everything the user could be authenticated with, other
+// than their password.
+func revokeUserCredentials(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE user_id = $1 AND scope = ANY($2)`
+	scopes := []string{ScopeAuthentication, ScopeRefresh, ScopeMFA}
+
+	_, err := tx.ExecContext(ctx, query, userID, pq.Array(scopes))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM api_keys WHERE user_id = $1`, userID)
+	return err
+}
+
+func (m TokenModel) DeleteByPlaintext(scope, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	DELETE FROM tokens
+	WHERE scope = $1 AND hash = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, scope, tokenHash[:])
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteSessionByPlaintext() ends the session of an authentication token, deleting the
+// token and the refresh token it was issued with in one statement.
+func (m TokenModel) DeleteSessionByPlaintext(tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	WITH token AS (
+		SELECT id, session_id FROM tokens WHERE scope = $1 AND hash = $2
+	)
+	DELETE FROM tokens
+	WHERE id IN (SELECT id FROM token UNION SELECT session_id FROM token)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, ScopeAuthentication, tokenHash[:])
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteForUser() removes a token by its ID, but only if it belongs to the given user.
+// The other token of its session goes with it: the authentication token of a refresh
+// token, or the refresh token of an authentication token.
+func (m TokenModel) DeleteForUser(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM tokens
+	WHERE user_id = $2
+	AND (id = $1 OR session_id = $1 OR id = (SELECT session_id FROM tokens WHERE id = $1 AND user_id = $2))`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForUser() returns the unexpired tokens of the given scopes, newest first.
+func (m TokenModel) GetAllForUser(userID int64, scopes ...string) ([]*Token, error) {
+	query := `
+	SELECT id, hash, user_id, expiry, scope, created_at, last_used_at, user_agent, ip
+	FROM tokens
+	WHERE user_id = $1 AND scope = ANY($2) AND expiry > $3 AND rotated_at IS NULL
+	ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(scopes), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+	for rows.Next() {
+		var token Token
+		err := rows.Scan(
+			&token.ID,
+			&token.Hash,
+			&token.UserID,
+			&token.Expiry,
+			&token.Scope,
+			&token.CreatedAt,
+			&token.LastUsedAt,
+			&token.UserAgent,
+			&token.IP,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// GetByPlaintext() looks up an unexpired token, including tokens which have already been
+// rotated so that callers can detect reuse.
+func (m TokenModel) GetByPlaintext(scope, tokenPlaintext string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	SELECT id, hash, user_id, expiry, scope, created_at, last_used_at, user_agent, ip, rotated_at
+	FROM tokens
+	WHERE scope = $1 AND hash = $2 AND expiry > $3`
+
+	var token Token
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, scope, tokenHash[:], time.Now()).Scan(
+		&token.ID,
+		&token.Hash,
+		&token.UserID,
+		&token.Expiry,
+		&token.Scope,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+		&token.UserAgent,
+		&token.IP,
+		&token.RotatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	token.Plaintext = tokenPlaintext
+	return &token, nil
+}
+
+// Rotate() marks a token as spent. It returns ErrEditConflict if the token has already been
+// rotated, which happens when two requests race to use the same refresh token.
+func (m TokenModel) Rotate(token *Token) error {
+	query := `
+	UPDATE tokens
+	SET rotated_at = NOW()
+	WHERE hash = $1 AND rotated_at IS NULL
+	RETURNING rotated_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, token.Hash).Scan(&token.RotatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateLastUsed() stamps the token as used now. To avoid a write on every request the
+// timestamp is only moved forward once it is more than a minute old.
+func (m TokenModel) UpdateLastUsed(scope, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	UPDATE tokens
+	SET last_used_at = NOW()
+	WHERE scope = $1 AND hash = $2
+	AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, scope, tokenHash[:])
+	return err
+}
+
 type MockTokenModel struct {
 	DB *sql.DB
 }
@@ -93,7 +361,7 @@ func (m MockTokenModel) New(userID int64, ttl time.Duration, scope string) (*Tok
 	if userID == 2 {
 		return nil, errors.New("some error")
 	}
-	return nil, nil
+	return generateToken(userID, ttl, scope)
 }
 
 func (m MockTokenModel) Insert(token *Token) error {
@@ -106,3 +374,122 @@ func (m MockTokenModel) DeleteAllForUser(scope string, userID int64) error {
 	}
 	return nil
 }
+
+func (m MockTokenModel) RevokeAllForUser(userID int64, audit *AuditEntry) error {
+	if userID == 2 {
+		return errors.New("error occurred")
+	}
+	return mockAudit(audit)
+}
+
+func (m MockTokenModel) NewSession(userID int64, ttl time.Duration, scope, userAgent, ip string, sessionID int64) (*Token, error) {
+	token, err := m.New(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	token.ID = 1
+	token.UserAgent = userAgent
+	token.IP = ip
+	token.SessionID = sessionID
+	return token, nil
+}
+
+func (m MockTokenModel) DeleteByPlaintext(scope, tokenPlaintext string) error {
+	if tokenPlaintext[len(tokenPlaintext)-1] == '5' {
+		return errors.New("error occurred")
+	}
+	return nil
+}
+
+func (m MockTokenModel) DeleteSessionByPlaintext(tokenPlaintext string) error {
+	if tokenPlaintext[len(tokenPlaintext)-1] == '5' {
+		return errors.New("error occurred")
+	}
+	return nil
+}
+
+func (m MockTokenModel) DeleteForUser(id, userID int64) error {
+	if userID == 2 {
+		return errors.New("error occurred")
+	}
+	if id != 1 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m MockTokenModel) GetAllForUser(userID int64, scopes ...string) ([]*Token, error) {
+	if userID == 2 {
+		return nil, errors.New("error occurred")
+	}
+
+	current := sha256.Sum256([]byte("TokenPlainTextForTokenTest"))
+	lastUsed := time.Now()
+
+	return []*Token{
+		{
+			ID:         1,
+			Hash:       current[:],
+			UserID:     userID,
+			Expiry:     time.Now().Add(24 * time.Hour),
+			Scope:      ScopeAuthentication,
+			CreatedAt:  time.Now(),
+			LastUsedAt: &lastUsed,
+			UserAgent:  "Go-http-client/1.1",
+			IP:         "127.0.0.1",
+		},
+		{
+			ID:        2,
+			Hash:      []byte("other"),
+			UserID:    userID,
+			Expiry:    time.Now().Add(24 * time.Hour),
+			Scope:     ScopeAuthentication,
+			CreatedAt: time.Now(),
+		},
+	}, nil
+}
+
+func (m MockTokenModel) UpdateLastUsed(scope, tokenPlaintext string) error {
+	if tokenPlaintext[len(tokenPlaintext)-1] == '6' {
+		return errors.New("error occurred")
+	}
+	return nil
+}
+
+func (m MockTokenModel) GetByPlaintext(scope, tokenPlaintext string) (*Token, error) {
+	token := &Token{
+		Plaintext: tokenPlaintext,
+		Hash:      []byte(tokenPlaintext),
+		UserID:    1,
+		Expiry:    time.Now().Add(time.Hour),
+		Scope:     scope,
+		CreatedAt: time.Now(),
+	}
+
+	switch tokenPlaintext[len(tokenPlaintext)-1] {
+	case '1':
+		return nil, ErrRecordNotFound
+	case '2':
+		return nil, errors.New("some err")
+	case '3':
+		rotatedAt := time.Now()
+		token.RotatedAt = &rotatedAt
+	case '4':
+		token.UserID = 3
+	case '5':
+		token.UserID = 2
+	case 'S':
+		token.UserID = 9
+	}
+
+	return token, nil
+}
+
+func (m MockTokenModel) Rotate(token *Token) error {
+	if token.UserID == 3 {
+		return ErrEditConflict
+	}
+	rotatedAt := time.Now()
+	token.RotatedAt = &rotatedAt
+	return nil
+}
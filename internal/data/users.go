@@ -5,6 +5,8 @@ import (
 	"crypto/sha256"
 	"database/sql" // New import
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -25,12 +27,22 @@ type User struct {
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
 	Version   int       `json:"-"`
+	// PendingEmail is the address the user has asked to change to, which only replaces
+	// Email once they confirm it.
+	PendingEmail *string `json:"pending_email,omitempty"`
+	// SuspendedAt is set while an admin has suspended the user. Unlike Activated, nothing
+	// the user can do clears it.
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
 }
 
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
@@ -112,11 +124,103 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, name, email, password_hash, activated, version, pending_email, suspended_at
+	FROM users
+	WHERE id = $1 AND deleted_at IS NULL`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.PendingEmail,
+		&user.SuspendedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// GetAll() returns users whose name or email contains search, optionally only those with
+// the given activation state.
+func (m UserModel) GetAll(search string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, name, email, password_hash, activated, version, pending_email, suspended_at
+	FROM users
+	WHERE (strpos(lower(name), lower($1)) > 0 OR strpos(lower(email::text), lower($1)) > 0 OR $1 = '')
+	AND (activated = $2 OR $2 IS NULL)
+	AND deleted_at IS NULL
+	ORDER BY %s %s, id ASC
+	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{search, activated, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	totalRecords := 0
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.hash,
+			&user.Activated,
+			&user.Version,
+			&user.PendingEmail,
+			&user.SuspendedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-	SELECT id, created_at, name, email, password_hash, activated, version
+	SELECT id, created_at, name, email, password_hash, activated, version, pending_email, suspended_at
 	FROM users
-	WHERE email = $1`
+	WHERE email = $1 AND deleted_at IS NULL`
 	var user User
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -128,6 +232,8 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.PendingEmail,
+		&user.SuspendedAt,
 	)
 	if err != nil {
 		switch {
@@ -143,14 +249,15 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 func (m UserModel) Update(user *User) error {
 	query := `
 	UPDATE users
-	SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-	WHERE id = $5 AND version = $6
+	SET name = $1, email = $2, password_hash = $3, activated = $4, pending_email = $5, version = version + 1
+	WHERE id = $6 AND version = $7 AND deleted_at IS NULL
 	RETURNING version`
 	args := []any{
 		user.Name,
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.PendingEmail,
 		user.ID,
 		user.Version,
 	}
@@ -174,13 +281,14 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version, users.pending_email, users.suspended_at
 	FROM users
 	INNER JOIN tokens
 	ON users.id = tokens.user_id
 	WHERE tokens.hash = $1
 	AND tokens.scope = $2
-	AND tokens.expiry > $3`
+	AND tokens.expiry > $3
+	AND users.deleted_at IS NULL`
 
 	args := []any{tokenHash[:], tokenScope, time.Now()}
 	var user User
@@ -195,6 +303,8 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.PendingEmail,
+		&user.SuspendedAt,
 	)
 	if err != nil {
 		switch {
@@ -208,6 +318,77 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	return &user, nil
 }
 
+// SetSuspended() suspends or unsuspends the user. Suspending also revokes everything the
+// user could authenticate with, in the same transaction. The version is left alone, so
+// that an admin suspending the user doesn't make the user's own edits conflict.
+func (m UserModel) SetSuspended(user *User, suspended bool, audit *AuditEntry) error {
+	query := `
+	UPDATE users
+	SET suspended_at = CASE WHEN $2 THEN COALESCE(suspended_at, NOW()) END
+	WHERE id = $1 AND deleted_at IS NULL
+	RETURNING suspended_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return withAudit(ctx, m.DB, audit, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, user.ID, suspended).Scan(&user.SuspendedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		if !suspended {
+			return nil
+		}
+		return revokeUserCredentials(ctx, tx, user.ID)
+	})
+}
+
+// SoftDelete() marks the user as deleted. From then on they are treated as if they don't
+// exist, until PurgeDeleted() removes them for good. Their email address is kept, but only
+// users who haven't been deleted need unique ones, so someone else can register it
+// straight away.
+func (m UserModel) SoftDelete(user *User) error {
+	query := `
+	UPDATE users
+	SET deleted_at = NOW(), version = version + 1
+	WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+	RETURNING version`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeDeleted() permanently deletes users that were soft-deleted before the given time.
+// Everything that belongs to them goes too, through ON DELETE CASCADE.
+func (m UserModel) PurgeDeleted(before time.Time) (int64, error) {
+	query := `
+	DELETE FROM users
+	WHERE deleted_at < $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
 type MockUserModel struct {
 	DB *sql.DB
 }
@@ -222,12 +403,48 @@ func (m MockUserModel) Insert(user *User) error {
 	if user.Name == "token fall" {
 		user.ID = 2
 	}
-	if user.Email != "email@gmail.com" {
+	if user.Email != "email@gmail.com" && !strings.HasSuffix(user.Email, "@idp.test") {
 		return ErrDuplicateEmail
 	}
 	return nil
 }
 
+func (m MockUserModel) Get(id int64) (*User, error) {
+	passwd := "TestPassword"
+	sha, _ := bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.MinCost)
+
+	switch id {
+	case 3:
+		return nil, ErrRecordNotFound
+	case 4:
+		return nil, errors.New("database has fallen")
+	case 9:
+		return mockSuspendedUser(), nil
+	}
+
+	return &User{
+		ID:        id,
+		CreatedAt: time.Now(),
+		Name:      "Test",
+		Email:     "test@test.com",
+		Password:  password{plaintext: &passwd, hash: sha},
+		Activated: true,
+		Version:   1,
+	}, nil
+}
+
+func (m MockUserModel) GetAll(search string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+	if search == "error" {
+		return nil, Metadata{}, errors.New("database has fallen")
+	}
+
+	users := []*User{
+		{ID: 1, CreatedAt: time.Now(), Name: "Test", Email: "test@test.com", Activated: true, Version: 1},
+	}
+
+	return users, calculateMetadata(len(users), filters.Page, filters.PageSize), nil
+}
+
 func (m MockUserModel) GetByEmail(email string) (*User, error) {
 	passwd := "TestPassword"
 	sha, _ := bcrypt.GenerateFromPassword([]byte(passwd), 10)
@@ -269,6 +486,38 @@ func (m MockUserModel) GetByEmail(email string) (*User, error) {
 			Activated: true,
 			Version:   1,
 		}, nil
+	case '6':
+		return &User{
+			ID:        1,
+			CreatedAt: time.Now(),
+			Name:      "Test",
+			Email:     "test@test.com",
+			Password:  password{plaintext: &passwd, hash: sha},
+			Activated: false,
+			Version:   1,
+		}, nil
+	case '7':
+		return &User{
+			ID:        2,
+			CreatedAt: time.Now(),
+			Name:      "Test",
+			Email:     "test@test.com",
+			Password:  password{plaintext: &passwd, hash: sha},
+			Activated: false,
+			Version:   1,
+		}, nil
+	case '8':
+		return &User{
+			ID:        5,
+			CreatedAt: time.Now(),
+			Name:      "Test",
+			Email:     "mfa@test.com",
+			Password:  password{plaintext: &passwd, hash: sha},
+			Activated: true,
+			Version:   1,
+		}, nil
+	case '9':
+		return mockSuspendedUser(), nil
 
 	}
 
@@ -283,10 +532,31 @@ func (m MockUserModel) GetByEmail(email string) (*User, error) {
 	}, nil
 }
 
+// mockSuspendedUser is user 9, who an admin has suspended. Their password is TestPassword.
+func mockSuspendedUser() *User {
+	passwd := "TestPassword"
+	sha, _ := bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.MinCost)
+	suspendedAt := time.Now().Add(-time.Hour)
+
+	return &User{
+		ID:          9,
+		CreatedAt:   time.Now(),
+		Name:        "Suspended",
+		Email:       "suspended@test.com",
+		Password:    password{plaintext: &passwd, hash: sha},
+		Activated:   false,
+		Version:     1,
+		SuspendedAt: &suspendedAt,
+	}
+}
+
 func (m MockUserModel) Update(user *User) error {
-	if user.Email == "testConflict@test.com" {
+	if user.Email == "testConflict@test.com" || user.Name == "Conflict" {
 		return ErrEditConflict
 	}
+	if user.Email == "testDuplicate@test.com" {
+		return ErrDuplicateEmail
+	}
 	if user.Email == "testErr@test.com" {
 		return errors.New("something went wrong")
 	}
@@ -299,6 +569,30 @@ func (m MockUserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, er
 	passwd := "testPassword"
 	sha, _ := bcrypt.GenerateFromPassword([]byte(passwd), 10)
 
+	if tokenScope == ScopeEmailChange {
+		var pendingEmail string
+		switch tokenPlaintext[len(tokenPlaintext)-1] {
+		case '9':
+			pendingEmail = "new@test.com"
+		case 'C':
+			pendingEmail = "testConflict@test.com"
+		case 'D':
+			pendingEmail = "testDuplicate@test.com"
+		}
+		if pendingEmail != "" {
+			return &User{
+				ID:           1,
+				CreatedAt:    time.Now(),
+				Name:         "Test",
+				Email:        "test@test.com",
+				Password:     password{plaintext: &passwd, hash: sha},
+				Activated:    true,
+				Version:      1,
+				PendingEmail: &pendingEmail,
+			}, nil
+		}
+	}
+
 	switch tokenPlaintext[len(tokenPlaintext)-1] {
 	case '1':
 		return nil, ErrRecordNotFound
@@ -334,6 +628,38 @@ func (m MockUserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, er
 			Activated: true,
 			Version:   1,
 		}, nil
+	case '0':
+		return &User{
+			ID:        7,
+			CreatedAt: time.Now(),
+			Name:      "Admin",
+			Email:     "admin@test.com",
+			Password:  password{plaintext: &passwd, hash: sha},
+			Activated: true,
+			Version:   1,
+		}, nil
+	case '7':
+		return &User{
+			ID:        5,
+			CreatedAt: time.Now(),
+			Name:      "Test",
+			Email:     "mfa@test.com",
+			Password:  password{plaintext: &passwd, hash: sha},
+			Activated: true,
+			Version:   1,
+		}, nil
+	case '8':
+		return &User{
+			ID:        6,
+			CreatedAt: time.Now(),
+			Name:      "Test",
+			Email:     "mfa@test.com",
+			Password:  password{plaintext: &passwd, hash: sha},
+			Activated: true,
+			Version:   1,
+		}, nil
+	case 'S':
+		return mockSuspendedUser(), nil
 
 	}
 
@@ -347,3 +673,28 @@ func (m MockUserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, er
 		Version:   1,
 	}, nil
 }
+
+func (m MockUserModel) SetSuspended(user *User, suspended bool, audit *AuditEntry) error {
+	if user.ID == 2 {
+		return errors.New("something went wrong")
+	}
+	if suspended {
+		suspendedAt := time.Now()
+		user.SuspendedAt = &suspendedAt
+	} else {
+		user.SuspendedAt = nil
+	}
+	return mockAudit(audit)
+}
+
+func (m MockUserModel) SoftDelete(user *User) error {
+	if user.ID == 6 {
+		return errors.New("something went wrong")
+	}
+	user.Version++
+	return nil
+}
+
+func (m MockUserModel) PurgeDeleted(before time.Time) (int64, error) {
+	return 0, nil
+}
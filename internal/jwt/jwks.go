@@ -0,0 +1,137 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+// ErrUnknownKey is returned by JWKS.Verify when no key matches the token's kid. Callers
+// that cache a JWKS should fetch it again, as the issuer may have rotated its keys.
+var ErrUnknownKey = errors.New("no matching key in JWKS")
+
+// JWK is a public key in the JSON Web Key format of RFC 7517. Only RSA and Ed25519 keys
+// are supported.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public half of the signer's key. Only asymmetric signers have one.
+func (s *Signer) JWK() (JWK, error) {
+	switch s.alg {
+	case AlgRS256:
+		return JWK{
+			Kty: "RSA",
+			Kid: s.kid,
+			Alg: AlgRS256,
+			Use: "sig",
+			N:   encoding.EncodeToString(s.rsaKey.N.Bytes()),
+			E:   encoding.EncodeToString(big.NewInt(int64(s.rsaKey.E)).Bytes()),
+		}, nil
+	case AlgEdDSA:
+		return JWK{
+			Kty: "OKP",
+			Kid: s.kid,
+			Alg: AlgEdDSA,
+			Use: "sig",
+			Crv: "Ed25519",
+			X:   encoding.EncodeToString(s.publicKey),
+		}, nil
+	default:
+		return JWK{}, errors.New("signer has no public key")
+	}
+}
+
+// Verify checks the signature of token against the key in the set named by the token's
+// kid, and decodes its payload into claims. As with Signer.Verify, the claims themselves
+// are not checked.
+func (set JWKS) Verify(token string, claims any) error {
+	h, payload, signingInput, signature, err := split(token)
+	if err != nil {
+		return err
+	}
+
+	key, ok := set.find(h)
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	switch {
+	case h.Alg == AlgRS256 && key.Kty == "RSA":
+		publicKey, err := key.rsaPublicKey()
+		if err != nil {
+			return ErrInvalidToken
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) != nil {
+			return ErrInvalidToken
+		}
+	case h.Alg == AlgEdDSA && key.Kty == "OKP" && key.Crv == "Ed25519":
+		x, err := encoding.DecodeString(key.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return ErrInvalidToken
+		}
+		if !ed25519.Verify(ed25519.PublicKey(x), []byte(signingInput), signature) {
+			return ErrInvalidToken
+		}
+	default:
+		return ErrInvalidToken
+	}
+
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+// find returns the key for the token header. A token without a kid can only be matched
+// when the set holds a single key.
+func (set JWKS) find(h header) (JWK, bool) {
+	if h.Kid == "" {
+		if len(set.Keys) == 1 {
+			return set.Keys[0], true
+		}
+		return JWK{}, false
+	}
+
+	for _, key := range set.Keys {
+		if key.Kid == h.Kid && (key.Alg == "" || key.Alg == h.Alg) {
+			return key, true
+		}
+	}
+	return JWK{}, false
+}
+
+func (k JWK) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := encoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := encoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
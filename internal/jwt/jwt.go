@@ -0,0 +1,191 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+var encoding = base64.RawURLEncoding
+
+// RegisteredClaims holds the standard claims from RFC 7519 which this package knows how to
+// validate. Embed it in an application specific claims struct.
+type RegisteredClaims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+func (c RegisteredClaims) Valid(now time.Time, issuer string) error {
+	if c.Issuer != issuer {
+		return ErrInvalidToken
+	}
+	if c.ExpiresAt == 0 || now.Unix() >= c.ExpiresAt {
+		return ErrExpiredToken
+	}
+	if c.NotBefore != 0 && now.Unix() < c.NotBefore {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+type Signer struct {
+	alg        string
+	kid        string
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+	rsaKey     *rsa.PrivateKey
+}
+
+func NewHS256(secret []byte) *Signer {
+	return &Signer{alg: AlgHS256, secret: secret}
+}
+
+func NewEdDSA(privateKey ed25519.PrivateKey) *Signer {
+	return &Signer{
+		alg:        AlgEdDSA,
+		privateKey: privateKey,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+	}
+}
+
+// NewRS256 returns a signer which puts kid in the header of every token, so that verifiers
+// can pick the matching key out of a JWKS.
+func NewRS256(privateKey *rsa.PrivateKey, kid string) *Signer {
+	return &Signer{alg: AlgRS256, kid: kid, rsaKey: privateKey}
+}
+
+func (s *Signer) Alg() string {
+	return s.alg
+}
+
+func (s *Signer) Sign(claims any) (string, error) {
+	h, err := json.Marshal(header{Alg: s.alg, Typ: "JWT", Kid: s.kid})
+	if err != nil {
+		return "", err
+	}
+
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encoding.EncodeToString(h) + "." + encoding.EncodeToString(p)
+
+	var signature []byte
+	switch s.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case AlgEdDSA:
+		signature = ed25519.Sign(s.privateKey, []byte(signingInput))
+	case AlgRS256:
+		digest := sha256.Sum256([]byte(signingInput))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, s.rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", errors.New("unsupported signing algorithm " + s.alg)
+	}
+
+	return signingInput + "." + encoding.EncodeToString(signature), nil
+}
+
+// Verify checks the signature of token and decodes its payload into claims. The algorithm
+// in the token header must match the signer's, so a token can't pick a weaker algorithm.
+// Verify does not look at the claims themselves; call RegisteredClaims.Valid for that.
+func (s *Signer) Verify(token string, claims any) error {
+	h, payload, signingInput, signature, err := split(token)
+	if err != nil {
+		return err
+	}
+
+	if h.Alg != s.alg {
+		return ErrInvalidToken
+	}
+
+	switch s.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return ErrInvalidToken
+		}
+	case AlgEdDSA:
+		if !ed25519.Verify(s.publicKey, []byte(signingInput), signature) {
+			return ErrInvalidToken
+		}
+	case AlgRS256:
+		digest := sha256.Sum256([]byte(signingInput))
+		if rsa.VerifyPKCS1v15(&s.rsaKey.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+			return ErrInvalidToken
+		}
+	default:
+		return ErrInvalidToken
+	}
+
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+func split(token string) (header, []byte, string, []byte, error) {
+	var h header
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return h, nil, "", nil, ErrInvalidToken
+	}
+
+	rawHeader, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return h, nil, "", nil, ErrInvalidToken
+	}
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return h, nil, "", nil, ErrInvalidToken
+	}
+
+	payload, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return h, nil, "", nil, ErrInvalidToken
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return h, nil, "", nil, ErrInvalidToken
+	}
+
+	return h, payload, parts[0] + "." + parts[1], signature, nil
+}
@@ -0,0 +1,331 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"greenlight.bcc/internal/jwt"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+)
+
+// Config describes an identity provider as given on the command line.
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// ParseConfig parses a provider description of the form
+// "name=google,issuer=https://accounts.google.com,client-id=...,client-secret=...,redirect-url=...".
+// Scopes may be given as a space separated "scopes" value; "openid email profile" is the
+// default.
+func ParseConfig(s string) (Config, error) {
+	cfg := Config{Scopes: []string{"openid", "email", "profile"}}
+
+	for _, field := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return cfg, fmt.Errorf("oidc provider: malformed field %q", field)
+		}
+
+		switch strings.TrimSpace(key) {
+		case "name":
+			cfg.Name = value
+		case "issuer":
+			cfg.Issuer = strings.TrimSuffix(value, "/")
+		case "client-id":
+			cfg.ClientID = value
+		case "client-secret":
+			cfg.ClientSecret = value
+		case "redirect-url":
+			cfg.RedirectURL = value
+		case "scopes":
+			cfg.Scopes = strings.Fields(value)
+		default:
+			return cfg, fmt.Errorf("oidc provider: unknown field %q", key)
+		}
+	}
+
+	switch {
+	case cfg.Name == "":
+		return cfg, errors.New("oidc provider: name must be provided")
+	case cfg.Issuer == "":
+		return cfg, fmt.Errorf("oidc provider %s: issuer must be provided", cfg.Name)
+	case cfg.ClientID == "":
+		return cfg, fmt.Errorf("oidc provider %s: client-id must be provided", cfg.Name)
+	case cfg.RedirectURL == "":
+		return cfg, fmt.Errorf("oidc provider %s: redirect-url must be provided", cfg.Name)
+	}
+
+	return cfg, nil
+}
+
+// Claims are the ID token claims used to identify the user.
+type Claims struct {
+	jwt.RegisteredClaims
+	Audience      audience `json:"aud"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// audience accepts the "aud" claim as either a single string or an array of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect relying party for one issuer. The discovery document and
+// signing keys are fetched on first use and cached; the keys are fetched again when a
+// token is signed with one that isn't known.
+type Provider struct {
+	Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      jwt.JWKS
+}
+
+func New(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{Config: cfg, client: client}
+}
+
+// NewPKCE returns a code verifier and its S256 code challenge, as described in RFC 7636.
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// NewNonce returns a random value for the state or nonce parameters.
+func NewNonce() (string, error) {
+	return randomString(32)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the URL to send the user to in order to log in at the provider.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	qs := url.Values{}
+	qs.Set("response_type", "code")
+	qs.Set("client_id", p.ClientID)
+	qs.Set("redirect_uri", p.RedirectURL)
+	qs.Set("scope", strings.Join(p.Scopes, " "))
+	qs.Set("state", state)
+	qs.Set("nonce", nonce)
+	qs.Set("code_challenge", codeChallenge)
+	qs.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return d.AuthorizationEndpoint + sep + qs.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the claims of the verified ID token.
+// The nonce must be the one given to AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, ErrExchangeFailed
+	}
+
+	var body struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(io.LimitReader(res.Body, 1_048_576)).Decode(&body)
+	if err != nil || body.IDToken == "" {
+		return nil, ErrExchangeFailed
+	}
+
+	return p.verify(ctx, body.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	keys, err := p.jwks(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	err = keys.Verify(idToken, &claims)
+	if errors.Is(err, jwt.ErrUnknownKey) {
+		keys, err = p.jwks(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		err = keys.Verify(idToken, &claims)
+	}
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	if claims.Valid(time.Now(), p.Issuer) != nil {
+		return nil, ErrInvalidIDToken
+	}
+	if !claims.Audience.contains(p.ClientID) || claims.Subject == "" || claims.Nonce != nonce {
+		return nil, ErrInvalidIDToken
+	}
+
+	return &claims, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d discovery
+	err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(d.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("oidc provider %s: discovery document is for issuer %q", p.Name, d.Issuer)
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+func (p *Provider) jwks(ctx context.Context, refresh bool) (jwt.JWKS, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return jwt.JWKS{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.keys.Keys) > 0 && !refresh {
+		return p.keys, nil
+	}
+
+	var keys jwt.JWKS
+	err = p.getJSON(ctx, d.JWKSURI, &keys)
+	if err != nil {
+		return jwt.JWKS{}, err
+	}
+
+	p.keys = keys
+	return p.keys, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc provider %s: GET %s returned %s", p.Name, url, res.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, 1_048_576)).Decode(dst)
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS totp_secrets (
+user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+secret text NOT NULL,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+confirmed_at timestamp(0) with time zone,
+last_used_step bigint NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+id bigserial PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+hash bytea NOT NULL,
+used_at timestamp(0) with time zone,
+UNIQUE (user_id, hash)
+);
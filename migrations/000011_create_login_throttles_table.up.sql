@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS login_throttles (
+email citext PRIMARY KEY,
+failed_attempts integer NOT NULL DEFAULT 0,
+window_start timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+locked_until timestamp(0) with time zone,
+lockouts integer NOT NULL DEFAULT 0
+);
+
+INSERT INTO permissions (code)
+VALUES
+('users:admin');
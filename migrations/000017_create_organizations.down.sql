@@ -0,0 +1,7 @@
+DROP POLICY IF EXISTS movies_org_isolation ON movies;
+ALTER TABLE movies NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE movies DISABLE ROW LEVEL SECURITY;
+DROP INDEX IF EXISTS movies_org_id_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS org_id;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS organizations (
+id bigserial PRIMARY KEY,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+name text NOT NULL,
+slug citext UNIQUE NOT NULL,
+version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+role text NOT NULL CHECK (role IN ('viewer', 'editor', 'admin', 'owner')),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_user_id_idx ON organization_members (user_id);
+
+-- Everything that exists so far belongs to the default organization, and everybody is an
+-- editor of it, so nobody can do less than before. What they can do is still limited by
+-- their global permissions.
+INSERT INTO organizations (name, slug)
+VALUES ('Default', 'default');
+
+INSERT INTO organization_members (org_id, user_id, role)
+SELECT organizations.id, users.id, 'editor'
+FROM organizations, users
+WHERE organizations.slug = 'default';
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS org_id bigint REFERENCES organizations ON DELETE CASCADE;
+UPDATE movies SET org_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE movies ALTER COLUMN org_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS movies_org_id_idx ON movies (org_id);
+
+-- Rows are only visible to, and can only be written by, a transaction which has set
+-- app.current_org_id to their organization. FORCE makes the policy apply to the table's
+-- owner too, which is usually the role the application connects as. Superusers and roles
+-- with BYPASSRLS are still exempt, so the application must not connect as one.
+ALTER TABLE movies ENABLE ROW LEVEL SECURITY;
+ALTER TABLE movies FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY movies_org_isolation ON movies
+USING (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint)
+WITH CHECK (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint);
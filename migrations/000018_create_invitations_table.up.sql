@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS invitations (
+id bigserial PRIMARY KEY,
+hash bytea UNIQUE NOT NULL,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+created_by bigint REFERENCES users ON DELETE SET NULL,
+email citext,
+role text REFERENCES roles (name) ON DELETE CASCADE,
+permissions text[] NOT NULL DEFAULT '{}',
+max_uses integer NOT NULL DEFAULT 1 CHECK (max_uses > 0),
+uses integer NOT NULL DEFAULT 0,
+expiry timestamp(0) with time zone
+);
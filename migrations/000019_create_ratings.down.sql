@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS ratings;
+DROP FUNCTION IF EXISTS ratings_update_movie();
+ALTER TABLE movies DROP COLUMN IF EXISTS average_rating;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_count;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_sum;
@@ -0,0 +1,65 @@
+CREATE TABLE IF NOT EXISTS ratings (
+movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+rating smallint NOT NULL CHECK (rating BETWEEN 1 AND 10),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+PRIMARY KEY (movie_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS ratings_user_id_idx ON ratings (user_id);
+
+-- The aggregates are kept on the movie so that listing can sort and filter on them
+-- without scanning ratings. Version isn't bumped, as a rating isn't an edit of the movie.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_sum bigint NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS average_rating numeric(4, 2) GENERATED ALWAYS AS (
+    CASE WHEN rating_count = 0 THEN 0 ELSE round(rating_sum::numeric / rating_count, 2) END
+) STORED;
+
+CREATE INDEX IF NOT EXISTS movies_average_rating_idx ON movies (org_id, average_rating);
+
+-- Each change to ratings adds its difference to the movie's aggregates in the same
+-- transaction. The UPDATE locks the movie's row, so concurrent ratings of one movie apply
+-- one after the other and the sum and count always match the ratings table.
+--
+-- Ratings are also deleted when their user is, with no organization set, so the trigger
+-- sets app.current_org_id to the rating's organization for its own UPDATE, or row-level
+-- security would hide the movie and the aggregates would silently drift.
+CREATE OR REPLACE FUNCTION ratings_update_movie() RETURNS trigger AS $$
+DECLARE
+    current_org text := current_setting('app.current_org_id', true);
+    movie bigint;
+    org bigint;
+    sum_delta bigint := 0;
+    count_delta integer := 0;
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        movie := OLD.movie_id;
+        org := OLD.org_id;
+        sum_delta := sum_delta - OLD.rating;
+        count_delta := count_delta - 1;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        movie := NEW.movie_id;
+        org := NEW.org_id;
+        sum_delta := sum_delta + NEW.rating;
+        count_delta := count_delta + 1;
+    END IF;
+
+    PERFORM set_config('app.current_org_id', org::text, true);
+
+    UPDATE movies
+    SET rating_sum = rating_sum + sum_delta, rating_count = rating_count + count_delta
+    WHERE id = movie;
+
+    PERFORM set_config('app.current_org_id', COALESCE(current_org, ''), true);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ratings_update_movie
+AFTER INSERT OR UPDATE OF rating OR DELETE ON ratings
+FOR EACH ROW EXECUTE FUNCTION ratings_update_movie();
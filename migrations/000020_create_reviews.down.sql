@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'reviews:moderate';
+DROP TABLE IF EXISTS review_reports;
+DROP TABLE IF EXISTS reviews;
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS reviews (
+id bigserial PRIMARY KEY,
+movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+body text NOT NULL,
+hidden boolean NOT NULL DEFAULT false,
+version integer NOT NULL DEFAULT 1,
+UNIQUE (movie_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS reviews_user_id_idx ON reviews (user_id);
+
+-- A report stays in the moderation queue until a moderator hides or keeps the review.
+-- Reporting a review again puts it back in the queue.
+CREATE TABLE IF NOT EXISTS review_reports (
+id bigserial PRIMARY KEY,
+review_id bigint NOT NULL REFERENCES reviews ON DELETE CASCADE,
+user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+reason text NOT NULL,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+resolved_at timestamp(0) with time zone,
+UNIQUE (review_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS review_reports_unresolved_idx ON review_reports (review_id) WHERE resolved_at IS NULL;
+
+INSERT INTO permissions (code)
+VALUES
+('reviews:moderate');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'reviews:moderate';
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS lists (
+id bigserial PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+name text NOT NULL,
+kind text NOT NULL CHECK (kind IN ('watchlist', 'watched', 'custom')),
+public boolean NOT NULL DEFAULT false,
+slug text UNIQUE NOT NULL,
+version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS lists_user_id_idx ON lists (user_id, org_id);
+
+-- Users have one watchlist and one watched list in each organization, and as many custom
+-- lists as they like.
+CREATE UNIQUE INDEX IF NOT EXISTS lists_user_id_org_id_kind_idx ON lists (user_id, org_id, kind) WHERE kind <> 'custom';
+
+CREATE TABLE IF NOT EXISTS list_items (
+list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+position integer NOT NULL,
+added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+watched_at timestamp(0) with time zone,
+PRIMARY KEY (list_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS list_items_movie_id_idx ON list_items (movie_id);
@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS people (
+id bigserial PRIMARY KEY,
+org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+name text NOT NULL,
+birth_year integer,
+bio text NOT NULL DEFAULT '',
+version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS people_org_id_idx ON people (org_id);
+CREATE INDEX IF NOT EXISTS people_name_idx ON people USING GIN (to_tsvector('simple', name));
+
+CREATE TABLE IF NOT EXISTS credits (
+id bigserial PRIMARY KEY,
+org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+person_id bigint NOT NULL REFERENCES people ON DELETE CASCADE,
+role text NOT NULL CHECK (role IN ('director', 'actor', 'writer')),
+character text NOT NULL DEFAULT '',
+UNIQUE (movie_id, person_id, role, character)
+);
+
+CREATE INDEX IF NOT EXISTS credits_person_id_idx ON credits (person_id, role);
+
+-- People and credits belong to organizations like the movies they are about, and are
+-- isolated in the same way.
+ALTER TABLE people ENABLE ROW LEVEL SECURITY;
+ALTER TABLE people FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY people_org_isolation ON people
+USING (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint)
+WITH CHECK (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint);
+
+ALTER TABLE credits ENABLE ROW LEVEL SECURITY;
+ALTER TABLE credits FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY credits_org_isolation ON credits
+USING (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint)
+WITH CHECK (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint);
@@ -0,0 +1,6 @@
+-- Keys of the images in the blob store. An empty key means the movie has no such image,
+-- and the thumbnails flags are set once the background job has generated them.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS poster_key text NOT NULL DEFAULT '';
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS poster_thumbnails boolean NOT NULL DEFAULT false;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS backdrop_key text NOT NULL DEFAULT '';
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS backdrop_thumbnails boolean NOT NULL DEFAULT false;
@@ -0,0 +1,108 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+id bigserial PRIMARY KEY,
+org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+version integer NOT NULL,
+action text NOT NULL CHECK (action IN ('baseline', 'insert', 'update', 'delete', 'restore')),
+user_id bigint REFERENCES users ON DELETE SET NULL,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+changes jsonb NOT NULL,
+snapshot jsonb NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS movie_revisions_movie_id_idx ON movie_revisions (movie_id, version);
+
+ALTER TABLE movie_revisions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE movie_revisions FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY movie_revisions_org_isolation ON movie_revisions
+USING (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint)
+WITH CHECK (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint);
+
+-- Movies which already exist get a baseline revision of how they are now, so that their
+-- history starts somewhere and this state can be reverted to after they are next edited.
+-- Row-level security only shows one organization's movies at a time, so it goes through
+-- them one by one, like MovieModel.PurgeDeleted().
+DO $$
+DECLARE
+    org bigint;
+BEGIN
+    FOR org IN SELECT id FROM organizations LOOP
+        PERFORM set_config('app.current_org_id', org::text, true);
+
+        INSERT INTO movie_revisions (org_id, movie_id, version, action, changes, snapshot)
+        SELECT org_id, id, version, 'baseline',
+            (SELECT jsonb_object_agg(key, jsonb_build_object('old', NULL, 'new', value)) FROM jsonb_each(fields)),
+            fields
+        FROM (
+            SELECT org_id, id, version, jsonb_build_object(
+                'title', title, 'year', year, 'runtime', runtime, 'genres', to_jsonb(genres)
+            ) AS fields
+            FROM movies
+        ) current_movies;
+    END LOOP;
+
+    PERFORM set_config('app.current_org_id', '', true);
+END;
+$$;
+
+-- Every write of a movie's fields is recorded by a trigger, so that nothing which changes
+-- a movie can forget to. The acting user is read from app.current_user_id, which the
+-- application sets alongside the organization, and is NULL for changes made outside it.
+--
+-- changes holds the fields which differ, each as {"old": ..., "new": ...}, and snapshot
+-- holds all of them as they were after the change so that a version can be reverted to
+-- without replaying the history. Updates which leave the fields alone, like the rating
+-- aggregates and images, aren't revisions. Deleting and restoring don't change the
+-- fields, and are recorded by their action alone. Purging deletes the history with the
+-- movie.
+CREATE OR REPLACE FUNCTION movies_record_revision() RETURNS trigger AS $$
+DECLARE
+    action text;
+    old_fields jsonb;
+    new_fields jsonb := jsonb_build_object(
+        'title', NEW.title, 'year', NEW.year, 'runtime', NEW.runtime, 'genres', to_jsonb(NEW.genres)
+    );
+    changes jsonb := '{}';
+    field text;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        action := 'insert';
+    ELSE
+        old_fields := jsonb_build_object(
+            'title', OLD.title, 'year', OLD.year, 'runtime', OLD.runtime, 'genres', to_jsonb(OLD.genres)
+        );
+
+        IF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            action := 'delete';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            action := 'restore';
+        ELSIF old_fields IS DISTINCT FROM new_fields THEN
+            action := 'update';
+        ELSE
+            RETURN NULL;
+        END IF;
+    END IF;
+
+    FOR field IN SELECT jsonb_object_keys(new_fields) LOOP
+        IF old_fields IS NULL OR old_fields -> field IS DISTINCT FROM new_fields -> field THEN
+            changes := changes || jsonb_build_object(
+                field, jsonb_build_object('old', old_fields -> field, 'new', new_fields -> field)
+            );
+        END IF;
+    END LOOP;
+
+    INSERT INTO movie_revisions (org_id, movie_id, version, action, user_id, changes, snapshot)
+    VALUES (
+        NEW.org_id, NEW.id, NEW.version, action,
+        NULLIF(current_setting('app.current_user_id', true), '')::bigint,
+        changes, new_fields
+    );
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_record_revision
+AFTER INSERT OR UPDATE ON movies
+FOR EACH ROW EXECUTE FUNCTION movies_record_revision();
@@ -0,0 +1,6 @@
+-- An authentication token is linked to the refresh token it was issued with, so that
+-- ending the session can revoke both. Deleting the refresh token takes the authentication
+-- token with it in any case.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS session_id bigint REFERENCES tokens ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS tokens_session_id_idx ON tokens (session_id);
@@ -0,0 +1,3 @@
+-- Admins suspend users instead of deactivating them, which the user could undo by
+-- activating their account again. Only the admin API sets suspended_at.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_at timestamp(0) with time zone;
@@ -0,0 +1,5 @@
+-- This fails while a deleted user and a newer one share an email address, until the
+-- deleted one has been purged.
+DROP INDEX IF EXISTS users_email_key;
+
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
@@ -0,0 +1,7 @@
+-- A deleted user keeps their email address until they are purged, but only users who
+-- haven't been deleted need unique ones, so the address can be registered again straight
+-- away. The index keeps the old constraint's name, which is what duplicate email errors
+-- are recognised by.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (email) WHERE deleted_at IS NULL;
@@ -0,0 +1,12 @@
+DROP POLICY IF EXISTS lists_public_read ON lists;
+DROP POLICY IF EXISTS lists_org_isolation ON lists;
+ALTER TABLE lists NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE lists DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS reviews_org_isolation ON reviews;
+ALTER TABLE reviews NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE reviews DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS ratings_org_isolation ON ratings;
+ALTER TABLE ratings NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE ratings DISABLE ROW LEVEL SECURITY;
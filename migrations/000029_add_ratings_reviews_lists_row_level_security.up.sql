@@ -0,0 +1,30 @@
+-- Ratings, reviews and lists belong to organizations like the movies they are about, and
+-- are isolated in the same way. Review reports and list items have no organization of
+-- their own, and are only reached through their review or list.
+ALTER TABLE ratings ENABLE ROW LEVEL SECURITY;
+ALTER TABLE ratings FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY ratings_org_isolation ON ratings
+USING (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint)
+WITH CHECK (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint);
+
+ALTER TABLE reviews ENABLE ROW LEVEL SECURITY;
+ALTER TABLE reviews FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY reviews_org_isolation ON reviews
+USING (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint)
+WITH CHECK (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint);
+
+ALTER TABLE lists ENABLE ROW LEVEL SECURITY;
+ALTER TABLE lists FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY lists_org_isolation ON lists
+USING (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint)
+WITH CHECK (org_id = NULLIF(current_setting('app.current_org_id', true), '')::bigint);
+
+-- Public lists can be read by anyone who has their slug, before it is known which
+-- organization they are in. Permissive policies are combined with OR, so this only adds
+-- reading public lists.
+CREATE POLICY lists_public_read ON lists
+FOR SELECT
+USING (public);